@@ -0,0 +1,129 @@
+package chess
+
+// Attack queries: which pieces attack a square, and whether a king is in
+// check. Unlike validMoves, these only care about what a piece could take,
+// so pawns attack diagonally whether or not anything is there.
+
+var knightJumps = []coord{{2, 1}, {2, -1}, {-2, 1}, {-2, -1}, {1, 2}, {1, -2}, {-1, 2}, {-1, -2}}
+var kingSteps = []coord{{1, 1}, {1, 0}, {1, -1}, {0, 1}, {0, -1}, {-1, 1}, {-1, 0}, {-1, -1}}
+var rookRays = []coord{{1, 0}, {-1, 0}, {0, 1}, {0, -1}}
+var bishopRays = []coord{{1, 1}, {1, -1}, {-1, 1}, {-1, -1}}
+
+func onBoard(row, col int) bool {
+	return row >= 1 && row <= 8 && col >= 0 && col <= 7
+}
+
+// pieceOf converts a black (uppercase) piece letter to the given color
+func pieceOf(piece byte, white bool) byte {
+	if white {
+		return piece + 32
+	}
+	return piece
+}
+
+// attackers returns the indexes of pieces of one color attacking a board index
+func (board Board) attackers(pos int, white bool) (ret []int) {
+	row, col := coordsFromIndex(pos)
+
+	at := func(r, c int, pieces ...byte) {
+		if !onBoard(r, c) {
+			return
+		}
+		i := indexFromCoords(r, c)
+		for _, p := range pieces {
+			if board[i] == pieceOf(p, white) {
+				ret = append(ret, i)
+			}
+		}
+	}
+
+	// white pawns attack up the board, black pawns down
+	dir := -1
+	if !white {
+		dir = 1
+	}
+	at(row+dir, col-1, 'P')
+	at(row+dir, col+1, 'P')
+
+	for _, j := range knightJumps {
+		at(row+j.row, col+j.col, 'N')
+	}
+
+	for _, s := range kingSteps {
+		at(row+s.row, col+s.col, 'K')
+	}
+
+	slide := func(rays []coord, pieces ...byte) {
+		for _, ray := range rays {
+			r, c := row+ray.row, col+ray.col
+			for onBoard(r, c) && board[indexFromCoords(r, c)] == '_' {
+				r, c = r+ray.row, c+ray.col
+			}
+			at(r, c, pieces...)
+		}
+	}
+
+	slide(rookRays, 'R', 'Q')
+	slide(bishopRays, 'B', 'Q')
+
+	return
+}
+
+// Attackers returns the squares ("E4") of white's (or black's) pieces that
+// attack a square
+func (board Board) Attackers(square string, white bool) ([]string, error) {
+	pos, err := board.Position(square)
+	if err != nil {
+		return nil, err
+	}
+
+	ret := []string{}
+	for _, i := range board.attackers(pos, white) {
+		ret = append(ret, indexName(i))
+	}
+
+	return ret, nil
+}
+
+// IsAttacked returns true if any of white's (or black's) pieces attack a
+// square; bad squares are never attacked
+func (board Board) IsAttacked(square string, white bool) bool {
+	pos, err := board.Position(square)
+	if err != nil {
+		return false
+	}
+
+	return len(board.attackers(pos, white)) > 0
+}
+
+// king returns the index of white's (or black's) king, or -1 if it's missing
+func (board Board) king(white bool) int {
+	for i := 0; i < len(board); i++ {
+		if board[i] == pieceOf('K', white) {
+			return i
+		}
+	}
+	return -1
+}
+
+// Checkers returns the squares of the pieces giving check to white's (or
+// black's) king
+func (board Board) Checkers(white bool) []string {
+	k := board.king(white)
+	if k == -1 {
+		return nil
+	}
+
+	ret := []string{}
+	for _, i := range board.attackers(k, !white) {
+		ret = append(ret, indexName(i))
+	}
+
+	return ret
+}
+
+// InCheck returns true if white's (or black's) king is in check
+func (board Board) InCheck(white bool) bool {
+	k := board.king(white)
+	return k != -1 && len(board.attackers(k, !white)) > 0
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/tqbf/chess"
+)
+
+// Finished games go into an archive, so they can be looked up after the
+// channel's game is reset.
+
+// ArchivedGame is a finished game
+type ArchivedGame struct {
+	// ID is assigned by the store when the game is first archived
+	ID int
+
+	Channel string
+	White   string
+	Black   string
+
+	// Result is the PGN result: "1-0", "0-1" or "1/2-1/2"
+	Result string
+	Date   time.Time
+	PGN    string
+
+	// Boards are the boards from the start of the game to the end, so the
+	// game can be replayed; Moves are the moves between them
+	Boards []chess.Board
+	Moves  []string
+
+	// Casual games don't count towards ratings
+	Casual bool
+}
+
+// result is the game's PGN result, "*" while it's still going
+func (game *Game) result() string {
+	switch {
+	case game.Drawn:
+		return "1/2-1/2"
+	case game.Winner == "":
+		return "*"
+	case game.Winner == game.White:
+		return "1-0"
+	}
+	return "0-1"
+}
+
+// pgn writes the game, with its variations, as PGN
+func (game *Game) pgn(site string, date time.Time) string {
+	if game.Line == nil {
+		return ""
+	}
+
+	return game.Line.PGN(map[string]string{
+		"Site":   site,
+		"Date":   date.Format("2006.01.02"),
+		"White":  game.White,
+		"Black":  game.Black,
+		"Result": game.result(),
+	})
+}
+
+// archive saves a game that's just finished, and says what it did to the
+// players' ratings; a game that's kept going and finished again replaces
+// its earlier entry
+func (game *Game) archive(ctx *Context) {
+	if !game.over() {
+		return
+	}
+
+	if t, ok := tournaments[tournamentKey(game.Tournament)]; ok && game.Tournament != "" {
+		defer t.result(ctx, game.Pairing, game.result())
+	}
+
+	if store == nil {
+		return
+	}
+
+	channel := ctx.Channel
+	now := time.Now()
+	a := &ArchivedGame{
+		ID:      game.ArchiveID,
+		Channel: channel,
+		White:   game.White,
+		Black:   game.Black,
+		Result:  game.result(),
+		Date:    now,
+		PGN:     game.pgn(ctx.site(), now),
+		Boards:  append(append([]chess.Board{}, game.Previous...), game.Board),
+		Moves:   game.Moves,
+		Casual:  game.Casual,
+	}
+
+	if err := store.Archive(a); err != nil {
+		log.Printf("can't archive game in %s: %s", channel, err)
+		return
+	}
+	game.ArchiveID = a.ID
+
+	announceRatings(ctx, a)
+}
+
+// describe is a one line summary of an archived game
+func (a *ArchivedGame) describe() string {
+	return fmt.Sprintf("*#%d* %s (white) vs %s (black), %s, %d moves, %s in #%s",
+		a.ID, a.White, a.Black, a.Result, len(a.Moves), a.Date.Format("Jan 2 2006"), a.Channel)
+}
+
+// findGames lists the archived games a player played, newest first, only
+// those against opponent if it isn't ""
+func findGames(player, opponent string) ([]*ArchivedGame, error) {
+	all, err := store.Archived()
+	if err != nil {
+		return nil, err
+	}
+
+	is := func(a, b string) bool {
+		return strings.EqualFold(strings.TrimPrefix(a, "@"), strings.TrimPrefix(b, "@"))
+	}
+
+	ret := []*ArchivedGame{}
+	for i := len(all) - 1; i >= 0; i-- {
+		a := all[i]
+		switch {
+		case is(a.White, player) && (opponent == "" || is(a.Black, opponent)):
+		case is(a.Black, player) && (opponent == "" || is(a.White, opponent)):
+		default:
+			continue
+		}
+		ret = append(ret, a)
+	}
+	return ret, nil
+}
+
+// listGames writes out the most recent of a list of games
+func listGames(found []*ArchivedGame, max int) string {
+	out := &bytes.Buffer{}
+	for i, a := range found {
+		if i == max {
+			fmt.Fprintf(out, "... and %d more.\n", len(found)-max)
+			break
+		}
+		fmt.Fprintf(out, "%s\n", a.describe())
+	}
+	return out.String()
+}
+
+// archivedGame finds a game in the archive by ID
+func archivedGame(id int) (*ArchivedGame, error) {
+	all, err := store.Archived()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, a := range all {
+		if a.ID == id {
+			return a, nil
+		}
+	}
+	return nil, fmt.Errorf("there's no game #%d", id)
+}
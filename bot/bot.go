@@ -2,72 +2,79 @@ package main
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
+	"image"
 	"log"
 	"net/http"
 	"os"
+	"path/filepath"
 	"regexp"
 	"strconv"
 	"strings"
 	"time"
 
 	"github.com/llgcode/draw2d/draw2dimg"
-	"github.com/nlopes/slack"
 	"github.com/tqbf/chess"
 )
 
 func main() {
-	os.Mkdir("/tmp/chess_boards", 0755)
+	var err error
+	if config, err = loadConfig(os.Args[1:]); err != nil {
+		log.Fatal(err)
+	}
 
-	go func() {
-		panic(http.ListenAndServe(":7777", http.FileServer(http.Dir("/tmp/chess_boards"))))
-	}()
+	chess.FontFolder = config.FontDir
 
-	api := slack.New(os.Getenv("BOT_TOKEN"))
-	rtm := api.NewRTM()
+	// boards are uploaded to Slack, unless there's somewhere to serve them
+	// from
+	if config.BoardURL != "" {
+		if err = os.MkdirAll(config.ImageDir, 0755); err != nil {
+			log.Fatalf("can't make image directory: %s", err)
+		}
 
-	go rtm.ManageConnection()
+		go func() {
+			panic(http.ListenAndServe(config.Listen, http.FileServer(http.Dir(config.ImageDir))))
+		}()
+	}
 
-	var inf *slack.Info
+	fs, err := NewFileStore(config.DataDir)
+	if err != nil {
+		log.Fatalf("can't store games in %s: %s", config.DataDir, err)
+	}
 
-Loop:
-	for {
-		select {
-		case msg := <-rtm.IncomingEvents:
-			switch ev := msg.Data.(type) {
-			case *slack.ChannelCreatedEvent:
-				Channels[ev.Channel.ID] = ev.Channel.Name
-
-			case *slack.PresenceChangeEvent:
-				users, _ := api.GetUsers()
-				for _, user := range users {
-					Users[user.ID] = user.Name
-				}
+	if games, err = fs.Load(); err != nil {
+		log.Fatalf("can't load games from %s: %s", config.DataDir, err)
+	}
+	store = fs
 
-			case *slack.ConnectedEvent:
-				inf = ev.Info
-				for _, channel := range ev.Info.Channels {
-					Channels[channel.ID] = channel.Name
-				}
+	if tournaments, err = fs.Tournaments(); err != nil {
+		log.Fatalf("can't load tournaments from %s: %s", config.DataDir, err)
+	}
 
-				for _, user := range ev.Info.Users {
-					Users[user.ID] = user.Name
-				}
+	var chat Messenger = newSlackMessenger(config.Token, config.SlackAPI)
 
-			case *slack.MessageEvent:
-				if ctx := ContextFromEvent(api, inf, ev); ctx != nil {
-					ctx.Incoming()
-				}
+	incoming := make(chan *Context, 16)
+	lost := make(chan error, 1)
+	go func() {
+		lost <- chat.Run(incoming)
+	}()
 
-			case *slack.HelloEvent:
-			case *slack.LatencyReport:
-			case *slack.RTMError:
-			case *slack.InvalidAuthEvent:
-				fmt.Printf("Invalid credentials")
-				break Loop
+	// clocks are checked from here, rather than on timers of their own, so
+	// games are only ever touched from this loop
+	ticker := time.NewTicker(time.Second)
 
-			default:
-			}
+	for {
+		select {
+		case ctx := <-incoming:
+			ctx.Incoming()
+
+		case err := <-lost:
+			log.Printf("lost %s: %s", chat.Platform(), err)
+			return
+
+		case now := <-ticker.C:
+			checkClocks(chat, now)
 		}
 	}
 }
@@ -88,7 +95,7 @@ type Game struct {
 	PlayingWhite bool
 
 	// Winner is the Slack user name of the winning player; the game is over when
-	// there's a winner (no draws right now)
+	// there's a winner (or it's Drawn)
 	Winner string
 
 	// BlackOk and WhiteOk determine whether it is OK to start the game
@@ -101,6 +108,42 @@ type Game struct {
 	WhiteElapsed time.Duration
 	BlackElapsed time.Duration
 
+	// Clock enforces the time control; nil means the game is untimed
+	Clock *chess.Clock
+
+	// WhiteWarned and BlackWarned are the last low-time warnings each
+	// player got
+	WhiteWarned time.Duration
+	BlackWarned time.Duration
+
+	// Drawn is true when the game ended without a winner
+	Drawn bool
+
+	// DrawOffer is the player who's offered a draw, until the other one
+	// accepts or a move is made
+	DrawOffer string
+
+	// ArchiveID is the game's number in the archive, once it's finished
+	ArchiveID int
+
+	// Casual games aren't rated; a game becomes casual once a move is taken
+	// back or the board is edited
+	Casual bool
+
+	// Tournament is the name of the tournament the game is part of, if
+	// any, and Pairing which of its pairings it is
+	Tournament string
+	Pairing    int
+
+	// Reminded is true once the player to move has been reminded of a
+	// correspondence deadline
+	Reminded bool
+
+	// WhiteVacation and BlackVacation are the vacation days each player
+	// has taken in a correspondence game
+	WhiteVacation int
+	BlackVacation int
+
 	Allowed bool
 
 	// Moves is the history of all previous moves
@@ -108,10 +151,78 @@ type Game struct {
 
 	// Boards is the history of all previous boards
 	Previous []chess.Board
+
+	// EditedWhite is, for board edits (the Moves starting with editMark),
+	// whether it was white's move before the edit, by index into Previous
+	EditedWhite map[int]bool
+
+	// EditedCastling is, for the same edits, the castling rights (as in
+	// FEN) they left
+	EditedCastling map[int]string
+
+	// Line is where we are in the game tree, which (unlike Moves) keeps
+	// lines that were taken back, as variations. It's saved separately
+	// (see savedGame), since the tree points back at itself.
+	Line *chess.Node `json:"-"`
 }
 
+// games are keyed by gameKey: the channel name for the channel's own game,
+// or the channel and thread for games in threads
 var games = map[string]*Game{}
 
+// gameKey is where a game lives in games
+func gameKey(channel, thread string) string {
+	if thread == "" {
+		return channel
+	}
+	return channel + "/" + thread
+}
+
+// splitKey splits a gameKey back into channel and thread
+func splitKey(key string) (channel, thread string) {
+	if i := strings.Index(key, "/"); i != -1 {
+		return key[:i], key[i+1:]
+	}
+	return key, ""
+}
+
+// mateRx is "chess mate in 3", or just "mate in 3"; maxMateIn is as deep as
+// the solver is allowed to go, and mateLimit is how long it gets, since
+// every other game waits while it looks
+const (
+	mateRx    = `^\s*(?:chess\s+)?mate\s+in\s+(\d+)\b`
+	maxMateIn = 4
+	mateLimit = time.Second
+)
+
+// concedeRx is "black wins" (or "white wins"), which a player can only say
+// about their opponent; drawRx is "draw", "offer a draw" or "accept the
+// draw", which both players have to say
+const (
+	concedeRx = `^\s*(black|white)\s+wins?\s*$`
+	drawRx    = `^\s*(?:chess\s+)?(?:(?:offer|accept)\s+(?:a\s+|the\s+)?)?draw\??\s*$`
+)
+
+// threadGameRx is what sets up a game in a thread that hasn't got one
+const threadGameRx = `claim.*(?:black|white)|time.*control\s+|` + correspondenceRx
+
+// correspondenceRx is "correspondence" or "chess correspondence 2d", a day
+// a move if it doesn't say; vacationRx is "chess vacation 3", in days
+const (
+	correspondenceRx = `^\s*(?:chess\s+)?correspondence\b(?:\s+(\d+\s*[a-z]*))?\s*$`
+	vacationRx       = `^\s*chess\s+vacation\s+(\d+)\s*$`
+)
+
+// the board editor's commands, which only work as whole messages, with or
+// without "chess" in front
+const (
+	putRx        = `^\s*(?:chess\s+)?put\s+(?:an?\s+)?(white|black)\s+(king|queen|rook|bishop|knight|pawn)\s+on\s+([a-h][1-8])\s*$`
+	removeRx     = `^\s*(?:chess\s+)?remove\s+(?:the\s+)?(?:piece\s+)?(?:on\s+|at\s+|from\s+)?([a-h][1-8])\s*$`
+	clearRx      = `^\s*(?:chess\s+)?clear\s+(?:the\s+)?board\s*$`
+	sideToMoveRx = `^\s*(?:chess\s+)?(white|black)\s+to\s+move\s*$`
+	castlingRx   = `^\s*(?:chess\s+)?castling\s+(?:rights\s+)?([kq]{1,4}|-|none)\s*$`
+)
+
 func match(rxs, message string) bool {
 	return matches(rxs, message) != nil
 }
@@ -127,105 +238,761 @@ type Context struct {
 	Channel string
 	User    string
 	Text    string
-	API     *slack.Client
+	Chat    Messenger
+
+	// Thread is the ID of the thread the message was in, which is where
+	// replies go; "" for messages in the channel itself
+	Thread string
+
+	// Message is the ID of the message itself, for reacting to it
+	Message string
 }
 
-// BUG(tqbf): these shouldn't be global variables
-var Channels = map[string]string{}
-var Users = map[string]string{}
+// contextForKey makes a Context for posting to a game, from its gameKey
+func contextForKey(chat Messenger, key string) *Context {
+	channel, thread := splitKey(key)
+	return &Context{
+		Channel: channel,
+		Thread:  thread,
+		Chat:    chat,
+	}
+}
 
-// ContextFromEvent creates a Context given the crap we get from the Slack RTM interface
-func ContextFromEvent(api *slack.Client, inf *slack.Info, ev *slack.MessageEvent) *Context {
-	var channel, user string
-	var ok bool
+// key is the gameKey of the game a message is about
+func (ctx *Context) key() string {
+	return gameKey(ctx.Channel, ctx.Thread)
+}
 
-	if ch := inf.GetChannelByID(ev.Channel); ch != nil {
-		channel = ch.Name
-	} else {
-		channel, ok = Channels[ev.Channel]
-		if !ok {
-			log.Printf("can't find channel with id %s", ev.Channel)
-			return nil
+// site is where the game is being played, for PGN
+func (ctx *Context) site() string {
+	return ctx.Chat.Platform() + " #" + ctx.Channel
+}
+
+// StartThread posts a message to the channel, returning a Context for
+// replying in a thread under it
+func (ctx *Context) StartThread(format string, args ...interface{}) (*Context, error) {
+	id, err := ctx.Chat.Post(ctx.Channel, "", fmt.Sprintf(format, args...))
+	if err != nil {
+		return nil, err
+	}
+
+	return &Context{
+		Channel: ctx.Channel,
+		User:    ctx.User,
+		Chat:    ctx.Chat,
+		Thread:  id,
+	}, nil
+}
+
+// DirectMessage sends a user (by NAME, like Game.White) a private message
+func (ctx *Context) DirectMessage(user, format string, args ...interface{}) error {
+	return ctx.Chat.DirectMessage(user, fmt.Sprintf(format, args...))
+}
+
+// React reacts to the message with an emoji
+func (ctx *Context) React(emoji string) error {
+	return ctx.Chat.React(ctx.Channel, ctx.Message, emoji)
+}
+
+// Post posts a simple text message to the channel (or thread) on which a message was received
+func (ctx *Context) Post(format string, args ...interface{}) {
+	ctx.Chat.Post(ctx.Channel, ctx.Thread, fmt.Sprintf(format, args...))
+}
+
+// PostLink posts a text message with an image attachment to the channel (or thread) on which a message was received
+func (ctx *Context) PostLink(link, title, format string, args ...interface{}) {
+	ctx.Chat.PostLink(ctx.Channel, ctx.Thread, link, title, fmt.Sprintf(format, args...))
+}
+
+// PostImage uploads an image to the channel (or thread), with a comment
+func (ctx *Context) PostImage(img image.Image, title, format string, args ...interface{}) error {
+	return ctx.Chat.PostImage(ctx.Channel, ctx.Thread, img, title, fmt.Sprintf(format, args...))
+}
+
+// DrawBoard posts a message with an attached chess board
+func (ctx *Context) DrawBoard(board chess.Board, reverse bool, hilights []chess.Highlight, format string, args ...interface{}) {
+	ctx.postBoard(board.Draw(400, reverse, hilights), fmt.Sprintf(format, args...))
+}
+
+// postBoard posts a drawing of a board, uploading it or linking to it
+// depending on the configuration
+func (ctx *Context) postBoard(dest image.Image, text string) {
+	if config.BoardURL == "" {
+		if err := ctx.PostImage(dest, "Game board", "%s", text); err != nil {
+			log.Printf("can't upload board to %s: %s", ctx.Channel, err)
+			ctx.Post("%s\n(I couldn't upload the board: %s)", text, err)
 		}
+		return
+	}
+
+	name := fmt.Sprintf("board-%s-%d.png", strings.Replace(ctx.key(), "/", "-", -1), time.Now().Unix())
+	draw2dimg.SaveToPngFile(filepath.Join(config.ImageDir, name), dest)
+
+	url := fmt.Sprintf("%s/%s", strings.TrimRight(config.BoardURL, "/"), name)
+	ctx.PostLink(url, "Game board", text)
+}
+
+// orList writes "a", "a or b", or "a, b or c"
+func orList(items []string) string {
+	if len(items) < 2 {
+		return strings.Join(items, "")
+	}
+	return strings.Join(items[:len(items)-1], ", ") + " or " + items[len(items)-1]
+}
+
+func pieceString(piece string) string {
+	switch strings.ToUpper(piece) {
+	case "P":
+		return "Pawn"
+	case "R":
+		return "Rook"
+	case "N":
+		return "Knight"
+	case "B":
+		return "Bishop"
+	case "Q":
+		return "Queen"
+	case "K":
+		return "King"
+	}
+	return ""
+}
+
+// describeSquares turns a list of squares into "Knight on C3, Pawn on F7"
+func describeSquares(board chess.Board, squares []string) string {
+	out := []string{}
+	for _, sq := range squares {
+		piece, _ := board.PieceAt(sq)
+		out = append(out, fmt.Sprintf("%s on %s", pieceString(piece), sq))
+	}
+	return strings.Join(out, ", ")
+}
+
+// threats describes the undefended and hanging pieces on both sides, and the
+// captures the side to move has that lose material
+func threats(board chess.Board, white bool) string {
+	msg := &bytes.Buffer{}
+
+	for _, side := range []bool{white, !white} {
+		name := "White"
+		if !side {
+			name = "Black"
+		}
+
+		if sq := board.Hanging(side); len(sq) > 0 {
+			fmt.Fprintf(msg, "%s is *hanging*: %s\n", name, describeSquares(board, sq))
+		}
+
+		if sq := board.Undefended(side); len(sq) > 0 {
+			fmt.Fprintf(msg, "%s has undefended: %s\n", name, describeSquares(board, sq))
+		}
+	}
+
+	losing := []string{}
+	for src := range board {
+		from := fmt.Sprintf("%c%d", 'A'+src%8, 8-src/8)
+		piece, _ := board.PieceAt(from)
+		if piece == "_" || (piece[0] >= 'a') != white {
+			continue
+		}
+
+		for dst := range board {
+			to := fmt.Sprintf("%c%d", 'A'+dst%8, 8-dst/8)
+			target, _ := board.PieceAt(to)
+			if target == "_" || (target[0] >= 'a') == white {
+				continue
+			}
+
+			alg, err := board.CoordsToAlgebraic(from, to)
+			if err != nil {
+				continue
+			}
+
+			if g, _ := board.SEECapture(from, to); g < 0 {
+				losing = append(losing, fmt.Sprintf("%s (loses %.1f points)", alg, float64(-g)/100))
+			}
+		}
+	}
+
+	if len(losing) > 0 {
+		fmt.Fprintf(msg, "Captures that lose material: %s\n", strings.Join(losing, ", "))
 	}
 
-	if us := inf.GetUserByID(ev.User); us != nil {
-		user = us.Name
+	if msg.Len() == 0 {
+		return "Nothing's hanging and nobody's undefended. Carry on."
+	}
+
+	return msg.String()
+}
+
+// describeLine turns a list of moves from a position into algebraic notation
+func describeLine(p chess.Position, line []string) string {
+	out := []string{}
+	for _, move := range line {
+		alg, err := p.SAN(move)
+		if err != nil {
+			break
+		}
+		p, _ = p.Play(move)
+
+		out = append(out, alg)
+	}
+	return strings.Join(out, " ")
+}
+
+// editedMoves works out, from the board snapshots, which moves in a game
+// can't be explained by a legal move (because someone knocked a piece out,
+// say); previous[i] is the board before move i
+func editedMoves(previous []chess.Board, current chess.Board) []bool {
+	ret := []bool{}
+	for i, before := range previous {
+		after := current
+		if i+1 < len(previous) {
+			after = previous[i+1]
+		}
+
+		_, _, err := chess.InferMove(before, after)
+		ret = append(ret, err != nil)
+	}
+	return ret
+}
+
+var pieceLetters = map[string]byte{
+	"king":   'K',
+	"queen":  'Q',
+	"rook":   'R',
+	"bishop": 'B',
+	"knight": 'N',
+	"pawn":   'P',
+}
+
+// makeCasual stops a game from being rated, saying why the first time
+func (game *Game) makeCasual(ctx *Context, why string) {
+	if game.Casual {
+		return
+	}
+
+	game.Casual = true
+	ctx.Post("Since %s, this game is casual now, and won't be rated.", why)
+}
+
+// editTo replaces the game's board with an edited position and shows it,
+// pointing out anything that makes it illegal
+func (game *Game) editTo(ctx *Context, p chess.Position, summary string) {
+	if !game.canEdit(ctx.User) {
+		ctx.Post("Only %s can set up the board in this game.", orList(game.players()))
+		return
+	}
+
+	// edits go in the history like moves, so they can be taken back
+	if game.EditedWhite == nil {
+		game.EditedWhite = map[int]bool{}
+	}
+	if game.EditedCastling == nil {
+		game.EditedCastling = map[int]string{}
+	}
+	game.EditedWhite[len(game.Previous)] = game.PlayingWhite
+	game.EditedCastling[len(game.Previous)] = p.Castling
+	game.Previous = append(game.Previous, game.Board)
+	game.Moves = append(game.Moves, editMark+summary)
+
+	game.Board = p.Board
+	game.PlayingWhite = p.WhiteToMove
+	game.Highlights = []chess.Highlight{}
+	game.syncClock(time.Now())
+
+	if err := p.Validate(); err != nil {
+		summary += fmt.Sprintf(" This isn't a legal position yet: %s.", err)
+	}
+
+	ctx.DrawBoard(game.Board, !game.PlayingWhite, game.Highlights, summary)
+	game.makeCasual(ctx, "the board was edited")
+}
+
+// castling works out who can still castle: whoever the last board edit
+// said could (everyone, if there hasn't been one), less anyone whose king
+// or rook has left its square since
+func (game *Game) castling() string {
+	rights, from := "KQkq", 0
+	for i := len(game.Previous) - 1; i >= 0; i-- {
+		if edited, ok := game.EditedCastling[i]; ok {
+			rights, from = edited, i+1
+			break
+		}
+	}
+
+	boards := append(append([]chess.Board{}, game.Previous[from:]...), game.Board)
+	for _, board := range boards {
+		possible := chess.PositionFromBoard(board, true).Castling
+
+		left := ""
+		for _, c := range rights {
+			if strings.ContainsRune(possible, c) {
+				left += string(c)
+			}
+		}
+		rights = left
+	}
+
+	return rights
+}
+
+// position is the game's board as a Position, with the side to move and
+// castling rights filled in
+func (game *Game) position() chess.Position {
+	p := chess.PositionFromBoard(game.Board, game.PlayingWhite)
+	p.Castling = game.castling()
+	return p
+}
+
+// editMark starts the Moves entry for a board edit
+const editMark = "edit: "
+
+// canEdit is true if a user can set up the board: one of the players, or
+// anyone before the game has any
+func (game *Game) canEdit(user string) bool {
+	return (game.White == "" && game.Black == "") || user == game.White || user == game.Black
+}
+
+// players are the game's players, one name if they're playing themselves
+func (game *Game) players() []string {
+	ret := []string{}
+	for _, name := range []string{game.White, game.Black} {
+		if name != "" && (len(ret) == 0 || ret[0] != name) {
+			ret = append(ret, name)
+		}
+	}
+	return ret
+}
+
+// vacationDays is how many days each player can take off from a
+// correspondence game
+const vacationDays = 14
+
+// lowTimeWarnings are when players get told they're running out of time
+var lowTimeWarnings = []time.Duration{time.Minute, 10 * time.Second}
+
+// clockString writes a time left on the clock, like "4:05" or "2d 3:00:00"
+func clockString(d time.Duration) string {
+	if d < 0 {
+		d = 0
+	}
+
+	days := d / (24 * time.Hour)
+	d -= days * 24 * time.Hour
+	h, m, sec := d/time.Hour, d%time.Hour/time.Minute, d%time.Minute/time.Second
+
+	switch {
+	case days > 0:
+		return fmt.Sprintf("%dd %d:%02d:%02d", days, h, m, sec)
+	case h > 0:
+		return fmt.Sprintf("%d:%02d:%02d", h, m, sec)
+	}
+	return fmt.Sprintf("%d:%02d", m, sec)
+}
+
+// over is true once the game has a result
+func (game *Game) over() bool {
+	return game.Winner != "" || game.Drawn
+}
+
+func (game *Game) warned(white bool) *time.Duration {
+	if white {
+		return &game.WhiteWarned
+	}
+	return &game.BlackWarned
+}
+
+// flagFell ends the game if the player to move has run out of time, and
+// says so; they lose, unless their opponent couldn't mate them anyway
+func (game *Game) flagFell(ctx *Context, now time.Time) bool {
+	if game.Clock == nil || game.over() || !game.Clock.Flagged(game.PlayingWhite, now) {
+		return false
+	}
+
+	game.Clock.Stop(now)
+
+	loser, name, winner := "White", game.White, game.Black
+	if !game.PlayingWhite {
+		loser, name, winner = "Black", game.Black, game.White
+	}
+
+	if game.Board.InsufficientMaterial(!game.PlayingWhite) {
+		game.Drawn = true
+		ctx.Post("%s (%s) is out of time, but there's nothing left to mate with, so the game is a *draw*.", loser, name)
+	} else if game.Clock.Control.PerMove {
+		game.Winner = winner
+		ctx.Post("%s (%s) missed the deadline to move, and forfeits. *%s* has won the game!", loser, name, game.Winner)
 	} else {
-		user, ok = Users[ev.User]
-		if !ok {
-			log.Printf("can't find user with id %s", ev.User)
-			return nil
+		game.Winner = winner
+		ctx.Post("%s (%s) is out of time. *%s* has won the game!", loser, name, game.Winner)
+	}
+
+	game.archive(ctx)
+	return true
+}
+
+// warnLowTime tells the player to move when they're getting short of time,
+// once for each of lowTimeWarnings
+func (game *Game) warnLowTime(ctx *Context, now time.Time) bool {
+	if game.Clock == nil || game.over() || game.Clock.Since.IsZero() {
+		return false
+	}
+
+	left := game.Clock.Remaining(game.PlayingWhite, now)
+	warned := game.warned(game.PlayingWhite)
+
+	for _, warning := range lowTimeWarnings {
+		if left > warning || (*warned != 0 && *warned <= warning) {
+			continue
+		}
+		// no sense warning about a minute in a one minute game
+		if game.Clock.Control.Periods[0].Time <= warning {
+			continue
+		}
+
+		*warned = warning
+
+		player := game.White
+		if !game.PlayingWhite {
+			player = game.Black
 		}
+		ctx.Post("%s, you have %s left on your clock.", player, clockString(left))
+		return true
 	}
 
-	return &Context{
-		Channel: channel,
-		User:    user,
-		Text:    ev.Text,
-		API:     api,
+	return false
+}
+
+// deadline is when the player to move has to have moved by
+func (game *Game) deadline(now time.Time) time.Time {
+	return now.Add(game.Clock.Remaining(game.PlayingWhite, now)).Truncate(time.Minute)
+}
+
+func (game *Game) vacation(white bool) *int {
+	if white {
+		return &game.WhiteVacation
 	}
+	return &game.BlackVacation
 }
 
-// Post posts a simple text message to the channel on which a message was received
-func (ctx *Context) Post(format string, args ...interface{}) {
-	ctx.API.PostMessage("#"+ctx.Channel, fmt.Sprintf(format, args...), slack.PostMessageParameters{
-		AsUser: true,
-	})
+// remind sends the player to move a direct message when a correspondence
+// deadline is getting close: once a move, with a quarter of the time left
+func (game *Game) remind(ctx *Context, now time.Time) bool {
+	if game.Clock == nil || game.over() || game.Clock.Since.IsZero() || game.Reminded {
+		return false
+	}
+
+	if game.Clock.Remaining(game.PlayingWhite, now) > game.Clock.Control.Periods[0].Time/4 {
+		return false
+	}
+
+	game.Reminded = true
+
+	player := game.White
+	if !game.PlayingWhite {
+		player = game.Black
+	}
+
+	err := ctx.DirectMessage(player, "It's your move in #%s, and you need to move by %s or forfeit the game. (Say _chess vacation 2_ in the channel if you need more time.)",
+		ctx.Channel, game.deadline(now).Format("Mon Jan 2 15:04 MST"))
+	if err != nil {
+		log.Printf("can't remind %s: %s", player, err)
+	}
+	return true
 }
 
-// PostLink posts a text message with an image attachment to the channel on which a message was received
-func (ctx *Context) PostLink(link, title, format string, args ...interface{}) {
-	p := slack.PostMessageParameters{
-		AsUser: true,
+// pressClock hands the move over on the clock, once a move has been made;
+// it fails, leaving the clock stopped, if the mover's flag fell first
+func (game *Game) pressClock(now time.Time) error {
+	if game.Clock == nil || game.Clock.Since.IsZero() {
+		return nil
 	}
 
-	text := fmt.Sprintf(format, args...)
+	white := game.Clock.WhiteToMove
+	if err := game.Clock.Press(now); err != nil {
+		return err
+	}
+	game.Reminded = false
 
-	p.Attachments = []slack.Attachment{
-		{
-			Title:    title,
-			ImageURL: link,
-		},
+	// an increment or a new period can buy back time; if so, warn again
+	// when it runs low
+	warned := game.warned(white)
+	if game.Clock.Remaining(white, now) > *warned {
+		*warned = 0
 	}
+	return nil
+}
 
-	ctx.API.PostMessage("#"+ctx.Channel, text, p)
+// unplay undoes the last move, for one that doesn't count after all
+func (game *Game) unplay() {
+	game.Board = game.Previous[len(game.Previous)-1]
+	game.Moves = game.Moves[0 : len(game.Moves)-1]
+	game.Previous = game.Previous[0 : len(game.Previous)-1]
+	if game.Line != nil && game.Line.Parent != nil {
+		game.Line = game.Line.Parent
+	}
 }
 
-// DrawBoard posts a message with an attached chess board
-func (ctx *Context) DrawBoard(board chess.Board, reverse bool, hilights []chess.Highlight, format string, args ...interface{}) {
-	dest := board.Draw(400, reverse, hilights)
-	fn := fmt.Sprintf("/tmp/chess_boards/board-%s-%d.png", ctx.Channel, time.Now().Unix())
-	draw2dimg.SaveToPngFile(fn, dest)
+// syncClock sets whichever clock should be running after the side to move
+// changes other than by moving
+func (game *Game) syncClock(now time.Time) {
+	if game.Clock == nil || game.Clock.Since.IsZero() || game.Clock.WhiteToMove == game.PlayingWhite {
+		return
+	}
+
+	game.Clock.Stop(now)
+	game.Clock.WhiteToMove = game.PlayingWhite
+	game.Clock.Start(now)
+}
+
+// checkClocks runs every second, ending games whose flag has fallen and
+// warning players who are low on time
+func checkClocks(chat Messenger, now time.Time) {
+	for key, game := range games {
+		if game.Clock == nil || game.over() || !game.Allowed {
+			continue
+		}
 
-	//url := fmt.Sprintf("http://9d0189ef.ngrok.io/%s", strings.Replace(fn, "/tmp/chess_boards/", "", -1))
-	url := fmt.Sprintf("http://sockpuppet.org:7777/%s", strings.Replace(fn, "/tmp/chess_boards/", "", -1))
-	ctx.PostLink(url, "Game board", fmt.Sprintf(format, args...))
+		ctx := contextForKey(chat, key)
+
+		changed := game.flagFell(ctx, now)
+		if !changed && game.Clock.Control.PerMove {
+			changed = game.remind(ctx, now)
+		} else if !changed {
+			changed = game.warnLowTime(ctx, now)
+		}
+
+		if changed {
+			saveGame(key)
+		}
+	}
+}
+
+// allow turns chess on or off for a channel, and every thread in it
+func allow(channel string, allowed bool) {
+	for key, game := range games {
+		if ch, _ := splitKey(key); ch == channel {
+			game.Allowed = allowed
+			saveGame(key)
+		}
+	}
 }
 
 // Incoming handles incoming messages, parses commands, and replies to them
 func (ctx *Context) Incoming() {
-	if ctx.User == "chessbot3000" {
+	if ctx.User == config.Name {
 		return
 	}
 
-	game, ok := games[ctx.Channel]
+	game, ok := games[ctx.key()]
 	if !ok {
-		game = &Game{
-			Board: chess.StartingBoard.Normalize(),
+		game = newGame()
+		// threads are allowed wherever their channel is
+		if top, ok := games[ctx.Channel]; ok && ctx.Thread != "" {
+			game.Allowed = top.Allowed
+		}
+		// but only get a game of their own once someone sets one up, so
+		// chatter in threads doesn't leave empty games everywhere
+		if ctx.Thread == "" || match(threadGameRx, ctx.Text) {
+			games[ctx.key()] = game
 		}
-		games[ctx.Channel] = game
 	}
 
 	clearHi := func() {
 		game.Highlights = []chess.Highlight{}
 	}
 
-	if !game.Allowed && !match("yo.*chessbot", ctx.Text) && !match("chess.*ok.*here", ctx.Text) && !match("help.*me.*chessbot", ctx.Text) {
+	if !game.Allowed && !matchesAny(config.Greetings, ctx.Text) && !match("chess.*ok.*here", ctx.Text) && !matchesAny(config.HelpPhrases, ctx.Text) {
 		return
 	}
 
+	// not everything changes the game, but it's simpler to save it anyway
+	defer saveGame(ctx.key())
+
 	switch {
+	case match("^\\s*chess\\s+new\\s+game\\b", ctx.Text):
+		thread, err := ctx.StartThread("%s wants a game of chess! Reply in this thread: _claim white_ (or _black_), then both say _start_.", ctx.User)
+		if err != nil {
+			ctx.Post("I couldn't start a thread: %s", err)
+			return
+		}
+
+		game := newGame()
+		game.Allowed = true
+		games[thread.key()] = game
+		saveGame(thread.key())
+
+	case match("^\\s*chess\\s+tournament\\b", ctx.Text):
+		ctx.tournamentCommand()
+
+	case match("^\\s*chess\\s+games\\b", ctx.Text):
+		if store == nil {
+			ctx.Post("I'm not keeping an archive of games.")
+			return
+		}
+
+		player := ctx.User
+		if tox := matches("\\bby\\s+(\\S+)", ctx.Text); tox != nil {
+			player = ctx.Chat.ParseUser(tox[1])
+		}
+
+		opponent := ""
+		if tox := matches("\\b(vs|versus|against)\\.?\\s+(\\S+)", ctx.Text); tox != nil {
+			opponent = ctx.Chat.ParseUser(tox[2])
+		}
+
+		found, err := findGames(player, opponent)
+		if err != nil {
+			ctx.Post("I can't read the archive: %s", err)
+			return
+		}
+
+		who := player
+		if opponent != "" {
+			who += " against " + opponent
+		}
+
+		if len(found) == 0 {
+			ctx.Post("I don't have any finished games by %s.", who)
+			return
+		}
+
+		ctx.Post("Games by %s, newest first (say _chess game 42_ to see one):\n%s", who, listGames(found, 10))
+
+	case match("^\\s*chess\\s+game\\s+#?([0-9]+)", ctx.Text):
+		tox := matches("^\\s*chess\\s+game\\s+#?([0-9]+)(.*move\\s+([0-9]+))?", ctx.Text)
+		id, _ := strconv.Atoi(tox[1])
+
+		if store == nil {
+			ctx.Post("I'm not keeping an archive of games.")
+			return
+		}
+
+		a, err := archivedGame(id)
+		if err != nil {
+			ctx.Post("I can't find that game: %s", err)
+			return
+		}
+
+		// "chess game 42 move 10" replays the game up to a move
+		which := len(a.Boards) - 1
+		summary := fmt.Sprintf("%s\nThe final position; say _chess game %d move 10_ to see earlier ones.", a.describe(), a.ID)
+		if tox[3] != "" {
+			n, _ := strconv.Atoi(tox[3])
+			if n < 1 || n > len(a.Moves) {
+				ctx.Post("Game #%d has %d moves.", a.ID, len(a.Moves))
+				return
+			}
+
+			which = n
+			side := "white"
+			if n%2 == 0 {
+				side = "black"
+			}
+			summary = fmt.Sprintf("Game #%d after move %d, %s (%s's)", a.ID, n, a.Moves[n-1], side)
+		}
+
+		ctx.DrawBoard(a.Boards[which], false, []chess.Highlight{}, summary)
+		if tox[3] == "" && a.PGN != "" {
+			ctx.Post("```%s```", a.PGN)
+		}
+
+	case match("^\\s*chess\\s+ratings\\b", ctx.Text):
+		if store == nil {
+			ctx.Post("I'm not keeping an archive of games, so there are no ratings.")
+			return
+		}
+
+		archive, err := store.Archived()
+		if err != nil {
+			ctx.Post("I can't read the archive: %s", err)
+			return
+		}
+
+		board := leaderboard(archive, ctx.Channel)
+		if board == "" {
+			ctx.Post("Nobody has finished a rated game here yet.")
+			return
+		}
+
+		ctx.Post("Ratings for #%s (\"?\" means provisional):\n%s", ctx.Channel, board)
+
+	case match("^\\s*chess\\s+rating\\b", ctx.Text):
+		player := ctx.User
+		if tox := matches("^\\s*chess\\s+rating\\s+(for\\s+)?(\\S+)", ctx.Text); tox != nil {
+			player = ctx.Chat.ParseUser(tox[2])
+		}
+
+		if store == nil {
+			ctx.Post("I'm not keeping an archive of games, so there are no ratings.")
+			return
+		}
+
+		archive, err := store.Archived()
+		if err != nil {
+			ctx.Post("I can't read the archive: %s", err)
+			return
+		}
+
+		history := ratingHistory(archive, player)
+		if history == "" {
+			ctx.Post("%s hasn't finished any rated games, so they're at %s.", player, ratingString(chess.NewRating()))
+			return
+		}
+
+		ctx.Post("Rating history for %s:\n%s", player, history)
+
+	case match("^\\s*chess\\s+stats\\b", ctx.Text):
+		player := ctx.User
+		if tox := matches("^\\s*chess\\s+stats\\s+(for\\s+)?(\\S+)", ctx.Text); tox != nil {
+			player = ctx.Chat.ParseUser(tox[2])
+		}
+
+		if store == nil {
+			ctx.Post("I'm not keeping an archive of games, so there are no stats.")
+			return
+		}
+
+		archive, err := store.Archived()
+		if err != nil {
+			ctx.Post("I can't read the archive: %s", err)
+			return
+		}
+
+		stats := playerStats(archive, player)
+		if stats == "" {
+			ctx.Post("%s hasn't finished any games against anyone.", player)
+			return
+		}
+
+		ctx.Post(stats)
+
+	case match("^\\s*chess\\s+(casual|rated)\\b", ctx.Text):
+		tox := matches("^\\s*chess\\s+(casual|rated)\\b", ctx.Text)
+		casual := strings.ToLower(tox[1]) == "casual"
+
+		// once the game's going, only take-backs and edits make it casual
+		if ctx.User != game.White && ctx.User != game.Black {
+			ctx.Post("Only %s can say whether this game is rated.", orList(game.players()))
+			return
+		}
+		if len(game.Moves) > 0 {
+			if game.Casual {
+				ctx.Post("This game has already started, so it stays casual.")
+			} else {
+				ctx.Post("This game has already started, so it stays rated.")
+			}
+			return
+		}
+
+		game.Casual = casual
+		if casual {
+			ctx.Post("Ok, this game is casual, and won't be rated.")
+		} else {
+			ctx.Post("Ok, this game will be rated.")
+		}
+
 	case match("claim.*black", ctx.Text):
 		game.Black = ctx.User
 		ctx.Post("Ok, the black player is now %s", ctx.User)
@@ -251,13 +1018,118 @@ func (ctx *Context) Incoming() {
 			ctx.Post("I've started the game; white's clock is ticking.")
 			game.PlayingWhite = true
 			game.TickFrom = time.Now()
+			if game.Clock != nil {
+				game.syncClock(game.TickFrom)
+				game.Clock.Start(game.TickFrom)
+			}
+		}
+
+	case match("time.*control\\s+(.+)", ctx.Text) || match(correspondenceRx, ctx.Text):
+		control := "1d per move"
+		if tox := matches("time.*control\\s+(.+)", ctx.Text); tox != nil {
+			control = tox[1]
+		} else if tox := matches(correspondenceRx, ctx.Text); tox[1] != "" {
+			control = tox[1] + " per move"
+		}
+
+		if game.Clock != nil && !game.Clock.Since.IsZero() {
+			ctx.Post("The clock is already running; reset the game to change the time control.")
+			return
+		}
+
+		if strings.ToLower(strings.TrimSpace(control)) == "none" {
+			game.Clock = nil
+			ctx.Post("Ok, this game is untimed.")
+			return
+		}
+
+		tc, err := chess.ParseTimeControl(control)
+		if err != nil {
+			ctx.Post("I don't understand that time control (try _5+3_ or _40/90,30+30_): %s", err)
+			return
+		}
+
+		game.Clock = chess.NewClock(tc)
+		if tc.PerMove {
+			ctx.Post("Ok, this is a correspondence game: %s. I'll remind you when your deadline is close, and you forfeit if you miss it. The clock starts when both players say start.", tc)
+			return
+		}
+		ctx.Post("Ok, the time control is %s. The clock starts when both players say start.", tc)
+
+	case match(vacationRx, ctx.Text):
+		tox := matches(vacationRx, ctx.Text)
+		days, _ := strconv.Atoi(tox[1])
+
+		if game.Clock == nil || !game.Clock.Control.PerMove {
+			ctx.Post("Vacations are only for correspondence games.")
+			return
+		}
+		if game.over() {
+			ctx.Post("The game is already over.")
+			return
+		}
+
+		white := ctx.User == game.White && (game.PlayingWhite || ctx.User != game.Black)
+		if !white && ctx.User != game.Black {
+			return
+		}
+
+		taken := game.vacation(white)
+		if days < 1 || *taken+days > vacationDays {
+			ctx.Post("You can take between 1 and %d more vacation days.", vacationDays-*taken)
+			return
 		}
 
+		*taken += days
+		game.Clock.Give(white, time.Duration(days)*24*time.Hour)
+		game.Reminded = false
+
+		ctx.Post("Ok, %s is taking %d vacation days (%d left), and the deadline for their next move is %d days later.", ctx.User, days, vacationDays-*taken, days)
+
+	case match("chess.*clock", ctx.Text):
+		if game.Clock == nil {
+			ctx.Post("This game isn't timed (set one with _time control 5+3_). White has used %s and black %s.",
+				game.WhiteElapsed.Round(time.Second), game.BlackElapsed.Round(time.Second))
+			return
+		}
+
+		now := time.Now()
+		msg := fmt.Sprintf("White (%s): %s\nBlack (%s): %s", game.White, clockString(game.Clock.Remaining(true, now)),
+			game.Black, clockString(game.Clock.Remaining(false, now)))
+		if game.Clock.Control.PerMove {
+			msg += fmt.Sprintf("\nVacation days left: white %d, black %d", vacationDays-game.WhiteVacation, vacationDays-game.BlackVacation)
+		}
+		switch {
+		case game.over():
+			msg += "\nThe game is over."
+		case game.Clock.Since.IsZero():
+			msg += "\nThe clock hasn't started."
+		case game.Clock.Control.PerMove && game.PlayingWhite:
+			msg += fmt.Sprintf("\nWhite has to move by %s.", game.deadline(now).Format("Mon Jan 2 15:04 MST"))
+		case game.Clock.Control.PerMove:
+			msg += fmt.Sprintf("\nBlack has to move by %s.", game.deadline(now).Format("Mon Jan 2 15:04 MST"))
+		case game.PlayingWhite:
+			msg += "\nWhite's clock is running."
+		default:
+			msg += "\nBlack's clock is running."
+		}
+		ctx.Post("Time control %s\n%s", game.Clock.Control, msg)
+
 	case ctx.Text == "O-O" || ctx.Text == "O-O-O" || match("([A-Ha-h][1-8])\\s?([A-Ha-h][1-8])", ctx.Text) || chess.AlgebraicRx.MatchString(ctx.Text):
 		if game.Winner != "" {
 			ctx.Post("%s has already won this game. Reset the game to make moves.", game.Winner)
 			return
 		}
+		if game.Drawn {
+			ctx.Post("This game was drawn. Reset the game to make moves.")
+			return
+		}
+		// the flag is checked and the clock pressed at the same moment, so
+		// a move can't sneak in after time runs out
+		now := time.Now()
+		if game.flagFell(ctx, now) {
+			return
+		}
 
 		var start, end string
 		var err error
@@ -272,6 +1144,12 @@ func (ctx *Context) Incoming() {
 			}
 
 			if start, end, err = game.Board.Algebraic(ctx.Text, white); err != nil {
+				var ambiguous *chess.AmbiguousMoveError
+				if errors.As(err, &ambiguous) {
+					ctx.Post("Did you mean %s?", orList(ambiguous.Candidates))
+					return
+				}
+
 				ctx.Post("I can't understand that move: %s", err)
 				return
 			}
@@ -314,31 +1192,28 @@ func (ctx *Context) Incoming() {
 				return err
 			}
 			game.Previous = append(game.Previous, game.Board)
+			game.DrawOffer = ""
 			if alg != "" {
 				game.Moves = append(game.Moves, alg)
 			} else {
 				game.Moves = append(game.Moves, fmt.Sprintf("%s-%s", start, end))
 			}
-			game.Board = board
-			return nil
-		}
 
-		pieceString := func(piece string) string {
-			switch strings.ToUpper(piece) {
-			case "P":
-				return "Pawn"
-			case "R":
-				return "Rook"
-			case "N":
-				return "Knight"
-			case "B":
-				return "Bishop"
-			case "Q":
-				return "Queen"
-			case "K":
-				return "King"
+			if game.Line == nil {
+				game.Line = chess.NewGame(game.position())
+			}
+			// if the board's been edited since the last move, the tree
+			// can't follow along by the rules
+			if next, err := game.Line.Play(start + "-" + end); err == nil && game.Line.Position.Board == game.Board {
+				game.Line = next
+			} else {
+				game.Line = game.Line.Add(game.Moves[len(game.Moves)-1], board)
 			}
-			return ""
+			// whatever was played after a take back is the real game now
+			game.Line.Promote()
+
+			game.Board = board
+			return nil
 		}
 
 		if ctx.User != game.White && ctx.User != game.Black {
@@ -349,9 +1224,15 @@ func (ctx *Context) Incoming() {
 				return
 			}
 
-			game.WhiteElapsed += time.Since(game.TickFrom)
+			if err := game.pressClock(now); err != nil {
+				// too late: the flag fell before the move was made
+				game.unplay()
+				game.flagFell(ctx, now)
+				return
+			}
+			game.WhiteElapsed += now.Sub(game.TickFrom)
 			game.PlayingWhite = false
-			game.TickFrom = time.Now()
+			game.TickFrom = now
 
 			var summary string
 			if endPiece != "_" {
@@ -360,6 +1241,10 @@ func (ctx *Context) Incoming() {
 				summary = fmt.Sprintf("White (%s) moves %s(%s -> %s)", game.White, alg, start, end)
 			}
 
+			if game.Board.InCheck(false) {
+				summary += " check!"
+			}
+
 			ctx.DrawBoard(game.Board, !game.PlayingWhite, game.Highlights, summary)
 
 		} else if ctx.User == game.Black && !game.PlayingWhite {
@@ -368,8 +1253,14 @@ func (ctx *Context) Incoming() {
 				return
 			}
 
-			game.BlackElapsed += time.Since(game.TickFrom)
-			game.TickFrom = time.Now()
+			if err := game.pressClock(now); err != nil {
+				// too late: the flag fell before the move was made
+				game.unplay()
+				game.flagFell(ctx, now)
+				return
+			}
+			game.BlackElapsed += now.Sub(game.TickFrom)
+			game.TickFrom = now
 			game.PlayingWhite = true
 
 			var summary string
@@ -379,6 +1270,10 @@ func (ctx *Context) Incoming() {
 				summary = fmt.Sprintf("Black (%s) moves %s(%s -> %s)", game.Black, alg, start, end)
 			}
 
+			if game.Board.InCheck(true) {
+				summary += " check!"
+			}
+
 			ctx.DrawBoard(game.Board, !game.PlayingWhite, game.Highlights, summary)
 		} else {
 			ctx.Post("It's not your turn.")
@@ -389,13 +1284,38 @@ func (ctx *Context) Incoming() {
 			ctx.Post("%s has already won this game. Reset the game to make moves.", game.Winner)
 			return
 		}
+		if game.Drawn {
+			ctx.Post("This game was drawn. Reset the game to make moves.")
+			return
+		}
 		if len(game.Previous) < 1 {
 			ctx.Post("There are no moves to take back.")
 			return
 		}
+		// the clock goes back to whoever's move it is again
+		defer game.syncClock(time.Now())
 
 		clearHi()
 
+		// either player can undo a board edit
+		if last := len(game.Previous) - 1; last < len(game.Moves) && strings.HasPrefix(game.Moves[last], editMark) {
+			if !game.canEdit(ctx.User) {
+				ctx.Post("You can't take that back.")
+				return
+			}
+
+			game.Board = game.Previous[last]
+			game.PlayingWhite = game.EditedWhite[last]
+			delete(game.EditedWhite, last)
+			delete(game.EditedCastling, last)
+
+			ctx.DrawBoard(game.Board, !game.PlayingWhite, game.Highlights, "%s undoes the edit (%s)", ctx.User, strings.TrimPrefix(game.Moves[last], editMark))
+
+			game.Moves = game.Moves[:last]
+			game.Previous = game.Previous[:last]
+			return
+		}
+
 		if ctx.User == game.White && !game.PlayingWhite {
 			game.Board = game.Previous[len(game.Previous)-1]
 			game.PlayingWhite = true
@@ -403,6 +1323,11 @@ func (ctx *Context) Incoming() {
 			ctx.DrawBoard(game.Board, !game.PlayingWhite, game.Highlights, "White (%s) takes back %s, white's move again", game.White, game.Moves[len(game.Moves)-1])
 
 			game.Moves = game.Moves[0 : len(game.Moves)-1]
+			game.Previous = game.Previous[0 : len(game.Previous)-1]
+			if game.Line != nil && game.Line.Parent != nil {
+				game.Line = game.Line.Parent
+			}
+			game.makeCasual(ctx, "a move was taken back")
 
 		} else if ctx.User == game.Black && game.PlayingWhite {
 			game.Board = game.Previous[len(game.Previous)-1]
@@ -410,18 +1335,37 @@ func (ctx *Context) Incoming() {
 			ctx.DrawBoard(game.Board, !game.PlayingWhite, game.Highlights, "Black (%s) takes back %s, black's move again", game.Black, game.Moves[len(game.Moves)-1])
 
 			game.Moves = game.Moves[0 : len(game.Moves)-1]
+			game.Previous = game.Previous[0 : len(game.Previous)-1]
+			if game.Line != nil && game.Line.Parent != nil {
+				game.Line = game.Line.Parent
+			}
+			game.makeCasual(ctx, "a move was taken back")
 		} else {
 			ctx.Post("You can't take a move back.")
 		}
 
+	case match("chess.*pgn", ctx.Text):
+		if game.Line == nil {
+			ctx.Post("No moves have been made yet.")
+			return
+		}
+
+		ctx.Post("```%s```", game.pgn(ctx.site(), time.Now()))
+
 	case match("chess.*history", ctx.Text):
 		out := &bytes.Buffer{}
 		mv := 1
+		edited := editedMoves(game.Previous, game.Board)
 		for i, move := range game.Moves {
+			note := ""
+			if i < len(edited) && edited[i] && !strings.HasPrefix(move, editMark) {
+				note = " _(board edited)_"
+			}
+
 			if i%2 == 0 {
-				fmt.Fprintf(out, "_%d_. *%s*", mv, move)
+				fmt.Fprintf(out, "_%d_. *%s*%s", mv, move, note)
 			} else {
-				fmt.Fprintf(out, " *%s*\n", move)
+				fmt.Fprintf(out, " *%s*%s\n", move, note)
 				mv += 1
 			}
 		}
@@ -429,11 +1373,98 @@ func (ctx *Context) Incoming() {
 		fmt.Fprintf(out, "\n")
 		ctx.Post("All moves:\n%s", out.String())
 
+	case match("chess.*threats", ctx.Text):
+		ctx.Post(threats(game.Board, game.PlayingWhite))
+
+	case match("chess.*eval", ctx.Text):
+		ctx.postBoard(game.Board.DrawEval(400, !game.PlayingWhite, game.Highlights),
+			fmt.Sprintf("Evaluation (plus is good for white):\n%s", game.Board.Evaluate()))
+
+	case match(mateRx, ctx.Text):
+		tox := matches(mateRx, ctx.Text)
+		n, err := strconv.Atoi(tox[1])
+		if err != nil || n < 1 || n > maxMateIn {
+			ctx.Post("I can only look for mates in 1 to %d moves.", maxMateIn)
+			return
+		}
+
+		side := "Black"
+		if game.PlayingWhite {
+			side = "White"
+		}
+
+		p := game.position()
+		line, ok, finished := p.MateWithin(n, mateLimit)
+		switch {
+		case ok:
+			ctx.Post("%s mates in %d: %s", side, (len(line)+1)/2, describeLine(p, line))
+		case !finished:
+			ctx.Post("I gave up looking for a mate in %d after %s; try fewer moves.", n, mateLimit)
+		default:
+			ctx.Post("%s has no mate in %d (at least, not by checking every move).", side, n)
+		}
+
+	case match(putRx, ctx.Text):
+		tox := matches(putRx, ctx.Text)
+
+		piece := pieceLetters[strings.ToLower(tox[2])]
+		if strings.ToLower(tox[1]) == "white" {
+			piece += 32
+		}
+
+		p, err := game.position().Put(piece, tox[3])
+		if err != nil {
+			ctx.Post("I can't do that: %s", err)
+			return
+		}
+		game.editTo(ctx, p, fmt.Sprintf("Put a %s %s on %s.", strings.ToLower(tox[1]), strings.ToLower(tox[2]), strings.ToUpper(tox[3])))
+
+	case match(removeRx, ctx.Text):
+		tox := matches(removeRx, ctx.Text)
+
+		p, err := game.position().Remove(tox[1])
+		if err != nil {
+			ctx.Post("I can't do that: %s", err)
+			return
+		}
+		game.editTo(ctx, p, fmt.Sprintf("Removed the piece (if any) on %s.", strings.ToUpper(tox[1])))
+
+	case match(clearRx, ctx.Text):
+		p := game.position().Clear()
+		game.editTo(ctx, p, "Cleared the board.")
+
+	case match(sideToMoveRx, ctx.Text):
+		tox := matches(sideToMoveRx, ctx.Text)
+		white := strings.ToLower(tox[1]) == "white"
+
+		p := game.position().SetSideToMove(white)
+		game.editTo(ctx, p, fmt.Sprintf("It's %s's move.", strings.ToLower(tox[1])))
+
+	case match(castlingRx, ctx.Text):
+		tox := matches(castlingRx, ctx.Text)
+		rights := tox[1]
+		if strings.ToLower(rights) == "none" {
+			rights = "-"
+		}
+
+		p, err := game.position().SetCastling(rights)
+		if err != nil {
+			ctx.Post("I can't do that: %s", err)
+			return
+		}
+
+		summary := fmt.Sprintf("Castling rights are %s.", p.Castling)
+		if p.Castling == "" {
+			summary = "Nobody can castle."
+		}
+		game.editTo(ctx, p, summary)
+
 	case match("board.*([0-9]+)", ctx.Text):
 		tox := matches("board.*([0-9]+)", ctx.Text)
 		which, _ := strconv.Atoi(tox[1])
-		if which > len(game.Previous) {
+		if which >= len(game.Previous) {
 			ctx.Post("I can't fetch previous board %d", which)
+			return
 		}
 
 		clearHi()
@@ -454,46 +1485,99 @@ func (ctx *Context) Incoming() {
 			game.Winner = game.White
 		}
 		ctx.Post("*%s* has won the game!", game.Winner)
+		game.archive(ctx)
 
 	case match("keep.*playing", ctx.Text):
 		game.Winner = ""
+		game.Drawn = false
 		ctx.Post("Ok. I've forgotten who won, so you can keep making moves.")
 
-	case match("(black|white) win(s)?", ctx.Text):
-		tox := matches("(black|white) wins", ctx.Text)
-		if tox[1] == "black" {
+	case match(concedeRx, ctx.Text):
+		tox := matches(concedeRx, ctx.Text)
+		black := strings.ToLower(tox[1]) == "black"
+
+		if game.over() {
+			ctx.Post("The game is already over.")
+			return
+		}
+		// only the loser can say so
+		if (black && ctx.User != game.White) || (!black && ctx.User != game.Black) {
+			ctx.Post("Only the player conceding can say that.")
+			return
+		}
+
+		if black {
 			game.Winner = game.Black
 		} else {
 			game.Winner = game.White
 		}
 		ctx.Post("*%s* has won the game!", game.Winner)
+		game.archive(ctx)
+
+	case match(drawRx, ctx.Text):
+		if ctx.User != game.White && ctx.User != game.Black {
+			ctx.Post("Only %s can agree to a draw.", orList(game.players()))
+			return
+		}
+		if game.over() {
+			ctx.Post("The game is already over.")
+			return
+		}
+
+		opponent := game.White
+		if ctx.User == game.White {
+			opponent = game.Black
+		}
+
+		// playing yourself, there's nobody else to ask
+		if (game.DrawOffer == "" || game.DrawOffer == ctx.User) && opponent != ctx.User {
+			game.DrawOffer = ctx.User
+			ctx.Post("%s offers a draw. %s, say _draw_ to accept, or just move.", ctx.User, opponent)
+			return
+		}
+
+		game.Drawn = true
+		game.DrawOffer = ""
+		ctx.Post("The game is a *draw*, by agreement.")
+		game.archive(ctx)
 
 	case match("knock.*out.*([A-Ha-h][1-9])", ctx.Text):
 		tox := matches("knock.*out.*([A-Ha-h][1-9])", ctx.Text)
 		start := strings.ToUpper(tox[1])
 
-		pos, _ := game.Board.Position(start)
-		game.Board = game.Board.Replace(rune('_'), pos)
-		ctx.Post("Removed piece (if any) at %s.", tox[1])
+		p, err := game.position().Remove(start)
+		if err != nil {
+			ctx.Post("I can't knock out %s: %s", tox[1], err)
+			return
+		}
+		game.editTo(ctx, p, fmt.Sprintf("Knocked out the piece (if any) on %s.", start))
 
-	case match("move.*game.*to.*(.*?)", ctx.Text):
-		tox := matches("move.*game.*to.*#?(.*?)", ctx.Text)
+	case match("move.*game.*to\\s+(\\S+)", ctx.Text):
+		tox := matches("move.*game.*to\\s+(\\S+)", ctx.Text)
+		to := tox[1]
+		if channels := ctx.Chat.ParseChannels(to); len(channels) > 0 {
+			to = channels[0]
+		}
 
-		if _, ok := Channels[tox[1]]; !ok {
-			ctx.Post("I don't know a channel called '%s', so I can't move the game there.", tox[1])
+		if !ctx.Chat.HasChannel(to) {
+			ctx.Post("I don't know a channel called '%s', so I can't move the game there.", to)
 			return
 		}
 
-		games[tox[1]] = game
-		games[ctx.Channel] = &Game{
-			Board: chess.StartingBoard.Normalize(),
+		games[to] = game
+		games[ctx.key()] = newGame()
+		games[ctx.key()].Allowed = game.Allowed
+		saveGame(to)
+
+		// the tournament has to know where its game went
+		if t, ok := tournaments[tournamentKey(game.Tournament)]; ok && game.Pairing < len(t.Pairings) {
+			t.Pairings[game.Pairing].Channel = to
+			saveTournament(t)
 		}
 
-		ctx.Post("Ok, I've moved this game to #%s and reset the game in this channel.", tox[1])
+		ctx.Post("Ok, I've moved this game to #%s and reset the game here.", to)
 
-	case match("yo.*chess.*bot", ctx.Text):
-		fallthrough
-	case match("what.*up.*chess", ctx.Text):
+	case matchesAny(config.Greetings, ctx.Text):
 		msg := &bytes.Buffer{}
 		fmt.Fprintf(msg, "I'm OK.\n")
 
@@ -503,6 +1587,8 @@ func (ctx *Context) Incoming() {
 
 		if game.Winner != "" {
 			fmt.Fprintf(msg, "The current game is over, and *%s* won it. Say 'reset game' to start a new one\n", game.Winner)
+		} else if game.Drawn {
+			fmt.Fprintf(msg, "The current game is over, and it was a draw. Say 'reset game' to start a new one\n")
 		} else if len(game.Moves) > 0 {
 			fmt.Fprintf(msg, "We're %d moves into the current game.\n", len(game.Moves))
 		}
@@ -527,45 +1613,83 @@ func (ctx *Context) Incoming() {
 			fmt.Fprintf(msg, "Nobody has claimed black.\n")
 		}
 
-		fmt.Fprintf(msg, "Please do not pentest chessbot3000.\n")
+		threads := 0
+		for key, g := range games {
+			if channel, thread := splitKey(key); channel == ctx.Channel && thread != "" && !g.over() && len(g.Moves) > 0 {
+				threads++
+			}
+		}
+		if threads > 0 {
+			fmt.Fprintf(msg, "There are %d games going in threads in this channel.\n", threads)
+		}
+
+		fmt.Fprintf(msg, "Please do not pentest %s.\n", config.Name)
 
 		ctx.Post(msg.String())
 
 	case match("definitely.*reset", ctx.Text):
-		ctx.Post("OK. I've reset the game. New players should claim spots and start.")
-		game = &Game{
-			Board:   chess.StartingBoard.Normalize(),
-			Allowed: true,
+		// the tournament is waiting on this game's result
+		if game.Tournament != "" && !game.over() {
+			ctx.Post("This is a game in %s, so it can't be reset until it's over. (Resign, or agree a draw, to end it.)", game.Tournament)
+			return
 		}
-		games[ctx.Channel] = game
+
+		ctx.Post("OK. I've reset the game. New players should claim spots and start.")
+		game = newGame()
+		game.Allowed = true
+		games[ctx.key()] = game
 
 	case match("reset.*game", ctx.Text):
 		ctx.Post("Are you sure? Say 'definitely reset' if you are.")
 
 	case match("chess.*ok.*here", ctx.Text):
-		game.Allowed = true
+		allow(ctx.Channel, true)
 		ctx.Post("Ok. I'll allow chess games here.")
 
 	case match("no.*chess.*here", ctx.Text):
-		game.Allowed = false
+		allow(ctx.Channel, false)
 		ctx.Post("Ok. I won't respond to chess events on this channel.")
 
-	case match("help.*me.*chessbot", ctx.Text):
-		fallthrough
-	case match("chess help", ctx.Text):
-		ctx.Post(`Here's what I know how to do (all commands case-insensitive):
+	case matchesAny(config.HelpPhrases, ctx.Text):
+		ctx.Post(strings.Replace(`Here's what I know how to do (all commands case-insensitive):
 _chess is ok here, thank you_: Allow chess events on this channel
+_chess new game_: Start a game in a thread of its own, so more than one game can go on here at once
 _claim_ _white_ (or _black_): Take a side
+_time control 5+3_: Play with a clock (also _40/90,30+30_, _5+2 delay_, _5+2 bronstein_ or _none_); say it before starting
+_correspondence 2d_: A correspondence game, with two days a move (one if you don't say)
+_chess vacation 3_: Take 3 days off from a correspondence game (two weeks' worth a game)
 _start_: Game starts once both players say this
 _A1 B2_ or _a1b2_: Make a move. *Only minimal validation is done.*
 _take back_: Take a move back
 _knock out D4_: Take the pawn at D4 en passant (or, you know, any other square)
+_put white queen on D4_: Set up a position, one piece at a time (players only, once the game's started; _chess_ in front is fine too)
+_remove D4_: Take the piece on D4 off the board
+_clear board_: Take every piece off the board
+_white to move_ (or _black_): Say whose move it is
+_castling KQk_: Say who can still castle, and which way, as in FEN (or _none_)
 _chess history_: See all previous moves
+_chess pgn_: The game as PGN, including lines that were taken back
+_chess games by alice_ (or _vs bob_, or both): List finished games
+_chess game 42_: Show a finished game (add _move 10_ to replay it up to there)
+_chess eval_: Explain who's ahead, and why
+_chess mate in 3?_: Look for a forced mate (checks only, up to 4 moves)
+_chess threats_: List hanging and undefended pieces, and captures that lose material
 _board_ <num>: Display earlier board #<num>
 _chess board_: Display the current board
+_chess casual_ (or _rated_): Whether this game counts for ratings; take-backs and edits make it casual
+_chess ratings_: The leaderboard for this channel
+_chess rating alice_: Alice's rating history
+_chess stats alice_: Alice's record, openings, streaks and head-to-head scores
+_chess tournament create office-cup swiss 5 rounds 10+5_: Make a tournament (or _round robin_; the time control is optional)
+_chess tournament join office-cup_ (or _leave_): Sign up
+_chess tournament office-cup boards #chess-1 #chess-2_: Play games in these channels, as many at once as there are
+_chess tournament start office-cup_: Pair the first round and start the games
+_chess tournament office-cup_: Standings, with Buchholz and Sonneborn-Berger tie-breaks (or _pairings_)
+_chess clock_: How much time each player has left
 _reset game_: Start over
 _i resign_: Resign the game
-_black_ (or _white_) _wins_: Declare a winner
+_black_ (or _white_) _wins_: Concede the game to your opponent
+_draw_: Offer a draw, or accept one
 _keep playing_: Un-declare a winner
 _move game to #foo_: Move the game to another channel. Stop annoying people.
 _what's up chessbot_: Current status
@@ -575,6 +1699,6 @@ _bing bong_
 Remember: you have to /invite me to a channel before I can annoy people on it.
 
 *Please do not pentest chessbot3000.*
-`)
+`, "chessbot3000", config.Name, -1))
 	}
 }
@@ -0,0 +1,383 @@
+package main
+
+import (
+	"image"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tqbf/chess"
+)
+
+// fakeChat is a Messenger that just remembers what the bot said
+type fakeChat struct {
+	posts []string
+
+	// ids is how many messages have been posted, for their IDs
+	ids int
+
+	// dms are "user: text"
+	dms []string
+}
+
+func (f *fakeChat) Platform() string                   { return "Fake" }
+func (f *fakeChat) Run(incoming chan<- *Context) error { return nil }
+
+func (f *fakeChat) Post(channel, thread, text string) (string, error) {
+	f.posts = append(f.posts, text)
+	f.ids++
+	return strconv.Itoa(f.ids), nil
+}
+
+func (f *fakeChat) PostLink(channel, thread, url, title, text string) error {
+	f.posts = append(f.posts, text)
+	return nil
+}
+
+func (f *fakeChat) PostImage(channel, thread string, img image.Image, title, text string) error {
+	f.posts = append(f.posts, text)
+	return nil
+}
+
+func (f *fakeChat) React(channel, message, emoji string) error { return nil }
+func (f *fakeChat) HasChannel(channel string) bool             { return channel == "chess" }
+func (f *fakeChat) ParseUser(word string) string               { return strings.TrimPrefix(word, "@") }
+
+func (f *fakeChat) DirectMessage(user, text string) error {
+	f.dms = append(f.dms, user+": "+text)
+	return nil
+}
+
+func (f *fakeChat) ParseChannels(text string) []string {
+	ret := []string{}
+	for _, word := range strings.Fields(text) {
+		if strings.HasPrefix(word, "#") {
+			ret = append(ret, word[1:])
+		}
+	}
+	return ret
+}
+
+// startGame sets up a game between alice (white) and bob in #chess, with
+// alice saying anything in setup before they start, and returns a function
+// to say things there, which gives back what the bot said in reply
+func startGame(t *testing.T, setup ...string) (*Game, func(user, text string) string) {
+	games = map[string]*Game{}
+
+	chat := &fakeChat{}
+	say := func(user, text string) string {
+		chat.posts = nil
+		(&Context{Channel: "chess", User: user, Text: text, Chat: chat}).Incoming()
+		return strings.Join(chat.posts, "\n")
+	}
+
+	say("alice", "chess ok here")
+	say("alice", "claim white")
+	say("bob", "claim black")
+	for _, text := range setup {
+		say("alice", text)
+	}
+	say("alice", "start")
+	say("bob", "start")
+
+	game := games["chess"]
+	if game == nil || game.White != "alice" || game.Black != "bob" {
+		t.Fatalf("game didn't start: %+v", game)
+	}
+	return game, say
+}
+
+func TestMoveAfterFlagFalls(t *testing.T) {
+	game, say := startGame(t)
+
+	tc, err := chess.ParseTimeControl("1+0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	game.Clock = chess.NewClock(tc)
+	game.Clock.Start(time.Now().Add(-2 * time.Minute))
+
+	said := say("alice", "e2 e4")
+	if !strings.Contains(said, "out of time") {
+		t.Errorf("move after the flag fell got %q", said)
+	}
+	if game.Winner != "bob" || len(game.Moves) != 0 || game.Board != chess.StartingBoard.Normalize() {
+		t.Errorf("winner %q, moves %v, board %s", game.Winner, game.Moves, game.Board)
+	}
+}
+
+func TestPressClockLate(t *testing.T) {
+	game, _ := startGame(t)
+
+	tc, err := chess.ParseTimeControl("1+2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	game.Clock = chess.NewClock(tc)
+
+	now := time.Now()
+	game.Clock.Start(now.Add(-30 * time.Second))
+	if err := game.pressClock(now); err != nil || game.Clock.WhiteToMove {
+		t.Fatalf("pressing in time: %v", err)
+	}
+
+	if err := game.pressClock(now.Add(2 * time.Minute)); err == nil {
+		t.Fatal("pressed the clock after black's flag fell")
+	}
+	if !game.Clock.Since.IsZero() || !game.Clock.Flagged(false, now.Add(2*time.Minute)) {
+		t.Errorf("clock should be stopped with black flagged: %+v", game.Clock)
+	}
+}
+
+func TestEvalCommand(t *testing.T) {
+	_, say := startGame(t)
+
+	if said := say("bob", "chess eval"); !strings.Contains(said, "Material: +0.00") || !strings.Contains(said, "Total: +0.00") {
+		t.Errorf("chess eval said %q", said)
+	}
+}
+
+func TestEditCommands(t *testing.T) {
+	game, say := startGame(t)
+	start := game.Board
+
+	if said := say("carol", "put white queen on d4"); !strings.Contains(said, "Only alice or bob") || game.Board != start {
+		t.Errorf("carol edited the board: %q", said)
+	}
+
+	say("alice", "put a white queen on d4")
+	if p := game.position(); p.Board[35] != 'q' || !game.Casual {
+		t.Errorf("after putting a queen on d4: %s", p.FEN())
+	}
+
+	say("bob", "chess remove e2")
+	say("bob", "knock out d7")
+	say("alice", "castling Kk")
+	if fen := game.position().FEN(); fen != "rnbqkbnr/ppp1pppp/8/8/3Q4/8/PPPP1PPP/RNBQKBNR w Kk - 0 1" {
+		t.Errorf("after removing e2 and d7, with only short castling: %s", fen)
+	}
+
+	// a king that moves loses its rights, and an edit can't give them back
+	say("alice", "e1 e2")
+	if castling := game.position().Castling; castling != "k" {
+		t.Errorf("after Ke2, castling is %q", castling)
+	}
+	say("bob", "white to move")
+	if !game.PlayingWhite {
+		t.Error("it's still black's move")
+	}
+
+	// take-backs undo edits one at a time, then moves
+	say("alice", "take back")
+	if game.PlayingWhite || game.position().Castling != "k" {
+		t.Errorf("after undoing black to move: %s", game.position().FEN())
+	}
+	say("alice", "take back")
+	if game.position().Castling != "Kk" {
+		t.Errorf("after taking back Ke2: %s", game.position().FEN())
+	}
+	say("bob", "take back")
+	if game.position().Castling != "KQkq" {
+		t.Errorf("after undoing the castling edit: %s", game.position().FEN())
+	}
+
+	say("alice", "clear the board")
+	if game.Board != chess.Board(strings.Repeat("_", 64)) || game.position().Castling != "" {
+		t.Errorf("cleared board is %s", game.Board)
+	}
+	if said := say("alice", "chess castling KQ"); !strings.Contains(said, "can't") {
+		t.Errorf("castled on an empty board: %q", said)
+	}
+
+	for range []string{"clear", "knock out", "remove", "put"} {
+		say("bob", "take back")
+	}
+	if game.Board != start || len(game.Moves) != 0 || len(game.EditedWhite) != 0 || len(game.EditedCastling) != 0 {
+		t.Errorf("after taking everything back: %s, %v", game.Board, game.Moves)
+	}
+
+	// the commands are whole messages
+	say("alice", "please don't put white queen on d4 yet")
+	if game.Board != start {
+		t.Error("edited the board from the middle of a sentence")
+	}
+}
+
+func TestFlagWithNothingToMate(t *testing.T) {
+	game, say := startGame(t)
+
+	p, err := chess.ParseFEN("4k3/8/8/8/8/8/P7/1N2K3 w - - 0 1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	game.Board = p.Board.Normalize()
+
+	tc, _ := chess.ParseTimeControl("1+0")
+	game.Clock = chess.NewClock(tc)
+	game.Clock.Start(time.Now().Add(-2 * time.Minute))
+
+	// white's flag falls, but black's bare king can't mate
+	if said := say("alice", "a2 a3"); !strings.Contains(said, "draw") || !game.Drawn || game.Winner != "" {
+		t.Errorf("white's flag fell against a bare king: %q", said)
+	}
+}
+
+func TestCorrespondence(t *testing.T) {
+	game, say := startGame(t, "chess correspondence 2d")
+	if game.Clock == nil || game.Clock.Control.String() != "2d per move" || game.Clock.Since.IsZero() {
+		t.Fatalf("clock is %+v", game.Clock)
+	}
+	start := game.Clock.Since
+
+	// one reminder, once a quarter of the time is left
+	chat := &fakeChat{}
+	checkClocks(chat, start.Add(36*time.Hour-time.Minute))
+	if len(chat.dms) != 0 {
+		t.Errorf("reminded too early: %q", chat.dms)
+	}
+	checkClocks(chat, start.Add(36*time.Hour+time.Minute))
+	checkClocks(chat, start.Add(40*time.Hour))
+	if len(chat.dms) != 1 || !strings.HasPrefix(chat.dms[0], "alice: It's your move in #chess") {
+		t.Errorf("reminders were %q", chat.dms)
+	}
+
+	if said := say("alice", "I'm going on vacation for 3 days"); strings.Contains(said, "vacation days") {
+		t.Errorf("took a vacation from the middle of a sentence: %q", said)
+	}
+	if said := say("alice", "chess vacation 15"); !strings.Contains(said, "between 1 and 14") {
+		t.Errorf("took 15 days: %q", said)
+	}
+	if said := say("alice", "chess vacation 3"); !strings.Contains(said, "3 vacation days (11 left)") || game.WhiteVacation != 3 {
+		t.Errorf("took 3 days: %q", said)
+	}
+
+	// the deadline moves back three days, with another reminder before it
+	deadline := start.Add(5 * 24 * time.Hour)
+	checkClocks(chat, deadline.Add(-time.Minute))
+	if game.over() || len(chat.dms) != 2 {
+		t.Errorf("before the new deadline: winner %q, reminders %q", game.Winner, chat.dms)
+	}
+
+	checkClocks(chat, deadline.Add(time.Minute))
+	if game.Winner != "bob" || !strings.Contains(strings.Join(chat.posts, "\n"), "missed the deadline to move, and forfeits") {
+		t.Errorf("after the deadline: winner %q, posts %q", game.Winner, chat.posts)
+	}
+
+	if said := say("bob", "chess vacation 2"); !strings.Contains(said, "already over") {
+		t.Errorf("vacation after the game: %q", said)
+	}
+}
+
+func TestCorrespondenceCommand(t *testing.T) {
+	for text, want := range map[string]string{
+		"correspondence":                     "1d per move",
+		"Chess correspondence 3d":            "3d per move",
+		"correspondence 12 hours":            "12h per move",
+		"let's play correspondence sometime": "",
+	} {
+		game, _ := startGame(t, text)
+
+		got := ""
+		if game.Clock != nil {
+			got = game.Clock.Control.String()
+		}
+		if got != want {
+			t.Errorf("%q set the time control to %q", text, got)
+		}
+	}
+}
+
+func TestConcede(t *testing.T) {
+	game, say := startGame(t)
+
+	for _, test := range []struct{ user, text string }{
+		{"alice", "white wins"},          // not alice's to say
+		{"carol", "black wins"},          // not a player
+		{"bob", "I bet white wins this"}, // not the whole message
+	} {
+		say(test.user, test.text)
+		if game.over() {
+			t.Fatalf("%s saying %q ended the game", test.user, test.text)
+		}
+	}
+
+	if said := say("bob", "White wins"); game.Winner != "alice" || !strings.Contains(said, "*alice* has won") {
+		t.Errorf("bob conceding got %q", said)
+	}
+	if said := say("alice", "black wins"); game.Winner != "alice" || !strings.Contains(said, "already over") {
+		t.Errorf("conceding a finished game got %q", said)
+	}
+}
+
+func TestDrawAgreement(t *testing.T) {
+	game, say := startGame(t)
+
+	if said := say("carol", "draw"); !strings.Contains(said, "Only alice or bob") || game.DrawOffer != "" {
+		t.Errorf("carol offered a draw: %q", said)
+	}
+
+	// offering twice isn't accepting, and a move takes the offer back
+	say("alice", "offer a draw")
+	say("alice", "draw?")
+	if game.Drawn || game.DrawOffer != "alice" {
+		t.Fatalf("after alice offers: drawn %v, offer %q", game.Drawn, game.DrawOffer)
+	}
+	say("alice", "e2 e4")
+	say("bob", "accept the draw")
+	if game.Drawn || game.DrawOffer != "bob" {
+		t.Fatalf("bob accepted an offer that lapsed: drawn %v, offer %q", game.Drawn, game.DrawOffer)
+	}
+
+	if said := say("alice", "chess draw"); !game.Drawn || game.Winner != "" || !strings.Contains(said, "*draw*") {
+		t.Errorf("alice accepting got %q", said)
+	}
+}
+
+func TestRatedCommand(t *testing.T) {
+	game, say := startGame(t)
+
+	if said := say("carol", "chess casual"); game.Casual || !strings.Contains(said, "Only alice or bob") {
+		t.Errorf("carol made the game casual: %q", said)
+	}
+
+	say("bob", "chess casual")
+	say("alice", "chess rated")
+	say("alice", "chess casual")
+	if !game.Casual {
+		t.Error("the players couldn't change their minds before moving")
+	}
+	say("bob", "chess rated")
+
+	say("alice", "e2 e4")
+	if said := say("alice", "chess casual"); game.Casual || !strings.Contains(said, "stays rated") {
+		t.Errorf("made the game casual after a move: %q", said)
+	}
+
+	say("alice", "take back")
+	say("alice", "e2 e4")
+	if said := say("bob", "chess rated"); !game.Casual || !strings.Contains(said, "stays casual") {
+		t.Errorf("rated a game with a take-back: %q", said)
+	}
+}
+
+func TestThreadGames(t *testing.T) {
+	games = map[string]*Game{}
+
+	chat := &fakeChat{}
+	say := func(user, thread, text string) {
+		(&Context{Channel: "chess", Thread: thread, User: user, Text: text, Chat: chat}).Incoming()
+	}
+
+	say("alice", "", "chess ok here")
+	say("alice", "100.1", "what a game that was")
+	say("bob", "100.1", "chess board")
+	if _, ok := games[gameKey("chess", "100.1")]; ok || len(games) != 1 {
+		t.Errorf("chatter in a thread made a game: %v", games)
+	}
+
+	say("alice", "100.2", "claim white")
+	if game := games[gameKey("chess", "100.2")]; game == nil || game.White != "alice" || !game.Allowed {
+		t.Errorf("claiming white in a thread didn't make a game: %+v", game)
+	}
+}
@@ -0,0 +1,259 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/tqbf/chess"
+)
+
+// Configuration comes from, in increasing order of priority: the defaults
+// below, a JSON config file (-config, or CHESSBOT_CONFIG), environment
+// variables, and command line flags. Lists (the trigger phrases) are
+// separated by ";" in the environment and on the command line. The config
+// file's keys are the names of Config's fields ("Token", "BoardURL" and so
+// on), and a key that isn't one of them is an error rather than a typo that
+// quietly leaves the default in place.
+
+// Config is everything the bot can be told at startup
+type Config struct {
+	// Token is the Slack API token (BOT_TOKEN)
+	Token string
+
+	// SlackAPI is where Slack's web API lives, which only changes to point
+	// the bot at a fake Slack
+	SlackAPI string
+
+	// Name is the Slack user name the bot runs as, so it can ignore itself
+	Name string
+
+	// BoardURL is the public address of the bot's own web server, which
+	// serves board images from ImageDir on Listen; if it's "", boards are
+	// uploaded to Slack instead
+	BoardURL string
+	Listen   string
+	ImageDir string
+
+	// FontDir is the directory with the "dejavumr.ttf" font the pieces are
+	// drawn with
+	FontDir string
+
+	// DataDir is where games, the archive and tournaments are saved
+	DataDir string
+
+	// TimeControl is the time control new games start with ("" for none)
+	TimeControl string
+
+	// Transport is how events get from Slack: "rtm", "socket" (Socket
+	// Mode, with AppToken) or "events" (the Events API, served on
+	// EventsListen at EventsPath and signed with SigningSecret)
+	Transport     string
+	AppToken      string
+	SigningSecret string
+	EventsListen  string
+	EventsPath    string
+
+	// Greetings and HelpPhrases are the (case-insensitive) regexps that get
+	// a status report or the help text, even where chess isn't allowed
+	Greetings   []string
+	HelpPhrases []string
+}
+
+// config is the running configuration
+var config = defaultConfig()
+
+func defaultConfig() Config {
+	return Config{
+		Name:         "chessbot3000",
+		SlackAPI:     "https://slack.com/api/",
+		Listen:       ":7777",
+		ImageDir:     "/tmp/chess_boards",
+		FontDir:      ".",
+		DataDir:      "chessbot_games",
+		Transport:    transportRTM,
+		EventsListen: ":3000",
+		EventsPath:   "/slack/events",
+		Greetings:    []string{"yo.*chess.*bot", "what.*up.*chess"},
+		HelpPhrases:  []string{"help.*me.*chessbot", "chess help"},
+	}
+}
+
+func splitList(s string) []string {
+	ret := []string{}
+	for _, item := range strings.Split(s, ";") {
+		if item = strings.TrimSpace(item); item != "" {
+			ret = append(ret, item)
+		}
+	}
+	return ret
+}
+
+// loadConfig works out the configuration from a config file, the
+// environment and the command line arguments
+func loadConfig(args []string) (Config, error) {
+	c := defaultConfig()
+
+	flags := flag.NewFlagSet("chessbot", flag.ContinueOnError)
+	file := flags.String("config", os.Getenv("CHESSBOT_CONFIG"), "JSON config `file`")
+
+	type setting struct {
+		flag, env, usage string
+		str              *string
+		list             *[]string
+	}
+
+	settings := []setting{
+		{"token", "BOT_TOKEN", "Slack API token", &c.Token, nil},
+		{"name", "CHESSBOT_NAME", "Slack user name the bot runs as", &c.Name, nil},
+		{"slack-api", "CHESSBOT_SLACK_API", "base URL of Slack's web API", &c.SlackAPI, nil},
+		{"board-url", "CHESSBOT_BOARD_URL", "public URL of the board image server (default: upload boards to Slack)", &c.BoardURL, nil},
+		{"listen", "CHESSBOT_BOARD_LISTEN", "address the board image server listens on", &c.Listen, nil},
+		{"image-dir", "CHESSBOT_IMAGE_DIR", "where board images are written for the image server", &c.ImageDir, nil},
+		{"font-dir", "CHESSBOT_FONT_DIR", "directory with dejavumr.ttf", &c.FontDir, nil},
+		{"data", "CHESSBOT_DATA", "where games are saved", &c.DataDir, nil},
+		{"time-control", "CHESSBOT_TIME_CONTROL", "time control for new games, like 10+5 (default: untimed)", &c.TimeControl, nil},
+		{"transport", "CHESSBOT_TRANSPORT", "how events get from Slack: rtm, socket or events", &c.Transport, nil},
+		{"app-token", "CHESSBOT_APP_TOKEN", "app-level token, for socket mode", &c.AppToken, nil},
+		{"signing-secret", "CHESSBOT_SIGNING_SECRET", "signing secret, for the events API", &c.SigningSecret, nil},
+		{"events-listen", "CHESSBOT_EVENTS_LISTEN", "address the events API server listens on", &c.EventsListen, nil},
+		{"events-path", "CHESSBOT_EVENTS_PATH", "path Slack posts events to", &c.EventsPath, nil},
+		{"greetings", "CHESSBOT_GREETINGS", "regexps for a status report, separated by ;", nil, &c.Greetings},
+		{"help-phrases", "CHESSBOT_HELP_PHRASES", "regexps for help, separated by ;", nil, &c.HelpPhrases},
+	}
+
+	// flags are set aside, so they can be applied last
+	flagged := map[string]string{}
+	for _, s := range settings {
+		name := s.flag
+		flags.Var(flagFunc(func(v string) error {
+			flagged[name] = v
+			return nil
+		}), s.flag, s.usage)
+	}
+
+	if err := flags.Parse(args); err != nil {
+		return c, err
+	}
+
+	if *file != "" {
+		f, err := os.Open(*file)
+		if err != nil {
+			return c, fmt.Errorf("can't read config file: %s", err)
+		}
+
+		dec := json.NewDecoder(f)
+		dec.DisallowUnknownFields()
+		err = dec.Decode(&c)
+		f.Close()
+		if err != nil {
+			return c, fmt.Errorf("can't parse config file %s: %s", *file, err)
+		}
+	}
+
+	for _, s := range settings {
+		for _, v := range []string{os.Getenv(s.env), flagged[s.flag]} {
+			switch {
+			case v == "":
+			case s.str != nil:
+				*s.str = v
+			default:
+				*s.list = splitList(v)
+			}
+		}
+	}
+
+	return c, c.validate()
+}
+
+// flagFunc is a flag.Value that calls a function when it's set
+type flagFunc func(string) error
+
+func (f flagFunc) String() string     { return "" }
+func (f flagFunc) Set(s string) error { return f(s) }
+
+// validate checks the configuration hangs together, returning every
+// problem at once
+func (c Config) validate() error {
+	problems := []string{}
+	problem := func(format string, args ...interface{}) {
+		problems = append(problems, fmt.Sprintf(format, args...))
+	}
+
+	if c.Token == "" {
+		problem("no Slack token (set BOT_TOKEN or -token)")
+	}
+
+	if c.Name == "" {
+		problem("the bot needs a name")
+	}
+
+	if c.BoardURL != "" {
+		if u, err := url.Parse(c.BoardURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			problem("board URL %q isn't an http or https URL", c.BoardURL)
+		}
+
+		if _, _, err := net.SplitHostPort(c.Listen); err != nil {
+			problem("can't listen on %q: %s", c.Listen, err)
+		}
+
+		if c.ImageDir == "" {
+			problem("the image server needs an image directory")
+		}
+	}
+
+	c.validTransport(problem)
+
+	if _, err := os.Stat(filepath.Join(c.FontDir, "dejavumr.ttf")); err != nil {
+		problem("can't find the font: %s", err)
+	}
+
+	if c.DataDir == "" {
+		problem("games need somewhere to be saved")
+	}
+
+	if c.TimeControl != "" {
+		if _, err := chess.ParseTimeControl(c.TimeControl); err != nil {
+			problem("default time control: %s", err)
+		}
+	}
+
+	for _, rx := range append(append([]string{}, c.Greetings...), c.HelpPhrases...) {
+		if _, err := regexp.Compile("(?i)" + rx); err != nil {
+			problem("bad trigger phrase %q: %s", rx, err)
+		}
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("bad configuration:\n  %s", strings.Join(problems, "\n  "))
+	}
+	return nil
+}
+
+// matchesAny is true if a message matches any of a list of phrases
+func matchesAny(phrases []string, message string) bool {
+	for _, rx := range phrases {
+		if match(rx, message) {
+			return true
+		}
+	}
+	return false
+}
+
+// newGame is an empty game, with the default time control
+func newGame() *Game {
+	game := &Game{
+		Board: chess.StartingBoard.Normalize(),
+	}
+
+	if tc, err := chess.ParseTimeControl(config.TimeControl); err == nil && config.TimeControl != "" {
+		game.Clock = chess.NewClock(tc)
+	}
+	return game
+}
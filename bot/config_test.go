@@ -0,0 +1,112 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// configDir is a directory with a font in it and, if file isn't "", a
+// config file, with the environment cleared of the bot's settings
+func configDir(t *testing.T, file string) string {
+	dir, err := ioutil.TempDir("", "chessbot")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	if err := ioutil.WriteFile(filepath.Join(dir, "dejavumr.ttf"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, env := range []string{"CHESSBOT_CONFIG", "BOT_TOKEN", "CHESSBOT_NAME", "CHESSBOT_DATA",
+		"CHESSBOT_TIME_CONTROL", "CHESSBOT_FONT_DIR", "CHESSBOT_GREETINGS", "CHESSBOT_TRANSPORT"} {
+		t.Setenv(env, "")
+	}
+
+	if file != "" {
+		if err := ioutil.WriteFile(filepath.Join(dir, "config.json"), []byte(file), 0644); err != nil {
+			t.Fatal(err)
+		}
+		t.Setenv("CHESSBOT_CONFIG", filepath.Join(dir, "config.json"))
+	}
+	return dir
+}
+
+func TestConfigPrecedence(t *testing.T) {
+	dir := configDir(t, `{
+		"Token": "file-token",
+		"Name": "file-name",
+		"DataDir": "file-data",
+		"TimeControl": "5+0",
+		"Greetings": ["file greeting"]
+	}`)
+
+	t.Setenv("CHESSBOT_FONT_DIR", dir)
+	t.Setenv("CHESSBOT_NAME", "env-name")
+	t.Setenv("CHESSBOT_DATA", "env-data")
+	t.Setenv("CHESSBOT_GREETINGS", "env one; env two;")
+
+	c, err := loadConfig([]string{"-data", "flag-data", "-time-control", "10+5"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, test := range []struct {
+		setting, got, want string
+	}{
+		{"token (file)", c.Token, "file-token"},
+		{"name (env over file)", c.Name, "env-name"},
+		{"data (flag over env)", c.DataDir, "flag-data"},
+		{"time control (flag over file)", c.TimeControl, "10+5"},
+		{"listen (default)", c.Listen, ":7777"},
+	} {
+		if test.got != test.want {
+			t.Errorf("%s is %q, not %q", test.setting, test.got, test.want)
+		}
+	}
+
+	if want := []string{"env one", "env two"}; !reflect.DeepEqual(c.Greetings, want) {
+		t.Errorf("greetings are %q, not %q", c.Greetings, want)
+	}
+
+	if want := defaultConfig().HelpPhrases; !reflect.DeepEqual(c.HelpPhrases, want) {
+		t.Errorf("help phrases are %q, not the defaults %q", c.HelpPhrases, want)
+	}
+}
+
+func TestConfigErrors(t *testing.T) {
+	for _, test := range []struct {
+		file string
+		args []string
+		want []string
+	}{
+		// a misspelled key doesn't just get ignored
+		{`{"Token": "x", "TimeControll": "10+5"}`, nil, []string{`unknown field "TimeControll"`}},
+		{`{"Token": "x",`, nil, []string{"can't parse config file"}},
+		// and everything wrong is reported at once
+		{`{"Name": "", "TimeControl": "forever", "BoardURL": "ftp://example.com", "Greetings": ["(oops"]}`,
+			[]string{"-transport", "carrier-pigeon"},
+			[]string{"no Slack token", "needs a name", "default time control", `board URL "ftp://example.com"`,
+				`bad trigger phrase "(oops"`, "carrier-pigeon"}},
+		{"", []string{"-token", "x", "-font-dir", "/nonexistent"}, []string{"can't find the font"}},
+	} {
+		dir := configDir(t, test.file)
+		t.Setenv("CHESSBOT_FONT_DIR", dir)
+
+		_, err := loadConfig(test.args)
+		if err == nil {
+			t.Errorf("%s %q: no error", test.file, test.args)
+			continue
+		}
+
+		for _, want := range test.want {
+			if !strings.Contains(err.Error(), want) {
+				t.Errorf("%s %q: error doesn't mention %q:\n%s", test.file, test.args, want, err)
+			}
+		}
+	}
+}
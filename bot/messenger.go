@@ -0,0 +1,46 @@
+package main
+
+import "image"
+
+// The chess logic only talks to a chat platform through a Messenger, so the
+// bot can run on anything with channels, threads and users. Channels and
+// users are always NAMES, the way people type them; it's up to each
+// Messenger to map them to whatever its platform uses underneath, and to
+// turn its own way of linking them in a message back into names.
+
+// A Messenger is a chat platform the bot plays on
+type Messenger interface {
+	// Platform is the platform's name, like "Slack"
+	Platform() string
+
+	// Run hands every message the bot sees to incoming, as a Context
+	// ready to be handled, until it loses the platform
+	Run(incoming chan<- *Context) error
+
+	// Post posts text to a channel, in a thread if thread isn't "",
+	// returning the new message's ID, which can start a thread of its own
+	Post(channel, thread, text string) (string, error)
+
+	// PostLink posts text with an image fetched from url
+	PostLink(channel, thread, url, title, text string) error
+
+	// PostImage uploads an image along with some text
+	PostImage(channel, thread string, img image.Image, title, text string) error
+
+	// React adds a reaction (an emoji name, like "white_check_mark") to
+	// a message
+	React(channel, message, emoji string) error
+
+	// DirectMessage sends a user a private message
+	DirectMessage(user, text string) error
+
+	// HasChannel is true if the bot is in a channel
+	HasChannel(channel string) bool
+
+	// ParseChannels lists the channels a message mentions, by name
+	ParseChannels(text string) []string
+
+	// ParseUser is the name of the user a word from a message mentions;
+	// a word that isn't a mention is taken to be a name already
+	ParseUser(word string) string
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/tqbf/chess"
+)
+
+// Glicko-2 ratings, worked out from the archive whenever they're needed, so
+// there's nothing extra to keep in step. Every rated game is its own rating
+// period. Casual games (anything with take-backs or a hand-edited board, or
+// a player playing themselves) don't count.
+
+// ratingChange is what one game did to a player's rating
+type ratingChange struct {
+	ID       int
+	Opponent string
+	Score    float64
+
+	Before, After chess.Rating
+}
+
+// rated is true if a game counts towards ratings
+func (a *ArchivedGame) rated() bool {
+	if a.Casual || a.White == "" || a.Black == "" || ratingKey(a.White) == ratingKey(a.Black) {
+		return false
+	}
+	return a.Result == "1-0" || a.Result == "0-1" || a.Result == "1/2-1/2"
+}
+
+// ratingKey is a player's name as ratings know it
+func ratingKey(player string) string {
+	return strings.ToLower(strings.TrimPrefix(player, "@"))
+}
+
+// ratings plays through the archive, returning everyone's current rating
+// and each player's history
+func ratings(archive []*ArchivedGame) (map[string]chess.Rating, map[string][]ratingChange) {
+	current := map[string]chess.Rating{}
+	history := map[string][]ratingChange{}
+
+	get := func(player string) chess.Rating {
+		if r, ok := current[player]; ok {
+			return r
+		}
+		return chess.NewRating()
+	}
+
+	for _, a := range archive {
+		if !a.rated() {
+			continue
+		}
+
+		white, black := ratingKey(a.White), ratingKey(a.Black)
+		score := map[string]float64{"1-0": 1, "0-1": 0, "1/2-1/2": 0.5}[a.Result]
+
+		w, b := get(white), get(black)
+		current[white] = w.Update([]chess.RatedResult{{Opponent: b, Score: score}})
+		current[black] = b.Update([]chess.RatedResult{{Opponent: w, Score: 1 - score}})
+
+		history[white] = append(history[white], ratingChange{a.ID, a.Black, score, w, current[white]})
+		history[black] = append(history[black], ratingChange{a.ID, a.White, 1 - score, b, current[black]})
+	}
+
+	return current, history
+}
+
+// ratingString writes a rating like "1662?" ("?" while provisional)
+func ratingString(r chess.Rating) string {
+	if r.Provisional() {
+		return fmt.Sprintf("%.0f?", r.Rating)
+	}
+	return fmt.Sprintf("%.0f", r.Rating)
+}
+
+func scoreString(score float64) string {
+	switch score {
+	case 1:
+		return "won"
+	case 0:
+		return "lost"
+	}
+	return "drew"
+}
+
+// leaderboard ranks the players who've played rated games in a channel
+func leaderboard(archive []*ArchivedGame, channel string) string {
+	current, _ := ratings(archive)
+
+	players := []string{}
+	seen := map[string]bool{}
+	for _, a := range archive {
+		if a.Channel != channel || !a.rated() {
+			continue
+		}
+		for _, p := range []string{ratingKey(a.White), ratingKey(a.Black)} {
+			if !seen[p] {
+				seen[p] = true
+				players = append(players, p)
+			}
+		}
+	}
+
+	if len(players) == 0 {
+		return ""
+	}
+
+	sort.Slice(players, func(i, j int) bool {
+		return current[players[i]].Rating > current[players[j]].Rating
+	})
+
+	out := &bytes.Buffer{}
+	for i, p := range players {
+		r := current[p]
+		fmt.Fprintf(out, "%d. *%s* %s (±%.0f)\n", i+1, p, ratingString(r), 2*r.Deviation)
+	}
+	return out.String()
+}
+
+// ratingHistory lists what each rated game did to a player's rating
+func ratingHistory(archive []*ArchivedGame, player string) string {
+	_, history := ratings(archive)
+
+	changes := history[ratingKey(player)]
+	if len(changes) == 0 {
+		return ""
+	}
+
+	out := &bytes.Buffer{}
+	for _, c := range changes {
+		fmt.Fprintf(out, "#%d %s against %s: %s -> %s (%+.0f)\n", c.ID, scoreString(c.Score), c.Opponent,
+			ratingString(c.Before), ratingString(c.After), c.After.Rating-c.Before.Rating)
+	}
+	return out.String()
+}
+
+// announceRatings says what a game that's just been archived did to its
+// players' ratings
+func announceRatings(ctx *Context, a *ArchivedGame) {
+	if !a.rated() {
+		ctx.Post("This was a casual game, so ratings don't change.")
+		return
+	}
+
+	archive, err := store.Archived()
+	if err != nil {
+		return
+	}
+
+	_, history := ratings(archive)
+
+	parts := []string{}
+	for _, player := range []string{a.White, a.Black} {
+		changes := history[ratingKey(player)]
+		for i := len(changes) - 1; i >= 0; i-- {
+			if c := changes[i]; c.ID == a.ID {
+				parts = append(parts, fmt.Sprintf("%s %s -> %s (%+.0f)", player, ratingString(c.Before), ratingString(c.After), c.After.Rating-c.Before.Rating))
+				break
+			}
+		}
+	}
+
+	if len(parts) > 0 {
+		ctx.Post("Ratings: %s", strings.Join(parts, ", "))
+	}
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// ratedArchive has one game of each kind that ratings have to tell apart
+var ratedArchive = []*ArchivedGame{
+	{ID: 1, Channel: "chess", White: "alice", Black: "bob", Result: "1-0"},
+	{ID: 2, Channel: "chess", White: "bob", Black: "alice", Result: "1-0", Casual: true},
+	{ID: 3, Channel: "chess", White: "carol", Black: "carol", Result: "1-0"},
+	{ID: 4, Channel: "chess", White: "carol", Black: "@Carol", Result: "0-1"},
+	{ID: 5, Channel: "general", White: "@Bob", Black: "dave", Result: "1/2-1/2"},
+	{ID: 6, Channel: "chess", White: "alice", Black: "erin", Result: "*"},
+}
+
+func TestRatings(t *testing.T) {
+	current, history := ratings(ratedArchive)
+
+	if len(current) != 3 || current["alice"].Rating <= 1500 || current["bob"].Rating >= 1500 || current["dave"].Rating >= 1500 {
+		t.Errorf("ratings are %+v", current)
+	}
+
+	// the casual game and carol's games against herself don't count
+	for player, ids := range map[string][]int{"alice": {1}, "bob": {1, 5}, "dave": {5}, "carol": nil, "erin": nil} {
+		got := []int{}
+		for _, c := range history[player] {
+			got = append(got, c.ID)
+		}
+		if fmt.Sprint(got) != fmt.Sprint(ids) {
+			t.Errorf("%s's rated games are %v, not %v", player, got, ids)
+		}
+	}
+
+	if ratingHistory(ratedArchive, "carol") != "" {
+		t.Error("carol has a rating history")
+	}
+	if h := ratingHistory(ratedArchive, "@Bob"); !strings.HasPrefix(h, "#1 lost against alice") || !strings.Contains(h, "\n#5 drew against dave") {
+		t.Errorf("bob's history is %q", h)
+	}
+}
+
+func TestLeaderboard(t *testing.T) {
+	board := leaderboard(ratedArchive, "chess")
+
+	lines := strings.Split(strings.TrimSpace(board), "\n")
+	if len(lines) != 2 || !strings.HasPrefix(lines[0], "1. *alice*") || !strings.HasPrefix(lines[1], "2. *bob*") {
+		t.Errorf("leaderboard is\n%s", board)
+	}
+
+	if leaderboard(ratedArchive, "random") != "" {
+		t.Error("a channel without games has a leaderboard")
+	}
+}
@@ -0,0 +1,319 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/png"
+	"log"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/nlopes/slack"
+)
+
+// The Slack Messenger. Events come in over one of the transports in
+// transport.go and replies go out through the web API. Slack knows
+// channels and users by ID, so this keeps track of their names.
+
+type slackMessenger struct {
+	api       *slack.Client
+	transport transport
+
+	// channel and user names by ID; the event loop fills them in while
+	// the bot is posting, hence the lock
+	lock     sync.Mutex
+	channels map[string]string
+	users    map[string]string
+}
+
+func newSlackMessenger(token, apiURL string) *slackMessenger {
+	// the client library keeps the API's URL in a package variable
+	slack.APIURL = apiURL
+
+	api := slack.New(token)
+	return &slackMessenger{
+		api:       api,
+		transport: newTransport(api),
+		channels:  map[string]string{},
+		users:     map[string]string{},
+	}
+}
+
+func (s *slackMessenger) Platform() string {
+	return "Slack"
+}
+
+func (s *slackMessenger) setName(names map[string]string, id, name string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	names[id] = name
+}
+
+func (s *slackMessenger) name(names map[string]string, id string) (string, bool) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	name, ok := names[id]
+	return name, ok
+}
+
+// id finds the ID for a name, "" if there isn't one
+func (s *slackMessenger) id(names map[string]string, name string) string {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	for id, n := range names {
+		if n == name {
+			return id
+		}
+	}
+	return ""
+}
+
+// loadNames learns every channel and user the bot can see; RTM says who's
+// who when it connects, but the other transports don't, and channels have
+// to be found by name before anyone's said anything in them
+func (s *slackMessenger) loadNames() error {
+	params := &slack.GetConversationsParameters{
+		Types: []string{"public_channel", "private_channel"},
+		Limit: 200,
+	}
+	for {
+		channels, cursor, err := s.api.GetConversations(params)
+		if err != nil {
+			return fmt.Errorf("can't list channels: %s", err)
+		}
+
+		for _, channel := range channels {
+			s.setName(s.channels, channel.ID, channel.Name)
+		}
+
+		if cursor == "" {
+			break
+		}
+		params.Cursor = cursor
+	}
+
+	users, err := s.api.GetUsers()
+	if err != nil {
+		return fmt.Errorf("can't list users: %s", err)
+	}
+
+	for _, user := range users {
+		s.setName(s.users, user.ID, user.Name)
+	}
+	return nil
+}
+
+func (s *slackMessenger) Run(incoming chan<- *Context) error {
+	if err := s.loadNames(); err != nil {
+		return err
+	}
+
+	events := make(chan interface{}, 16)
+	lost := make(chan error, 1)
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		lost <- s.transport.run(events, stop)
+	}()
+
+	for {
+		select {
+		case err := <-lost:
+			return err
+
+		case msg := <-events:
+			switch ev := msg.(type) {
+			case *slack.ChannelCreatedEvent:
+				s.setName(s.channels, ev.Channel.ID, ev.Channel.Name)
+
+			case *slack.PresenceChangeEvent:
+				users, _ := s.api.GetUsers()
+				for _, user := range users {
+					s.setName(s.users, user.ID, user.Name)
+				}
+
+			case *slack.ConnectedEvent:
+				for _, channel := range ev.Info.Channels {
+					s.setName(s.channels, channel.ID, channel.Name)
+				}
+
+				for _, user := range ev.Info.Users {
+					s.setName(s.users, user.ID, user.Name)
+				}
+
+			case *slack.MessageEvent:
+				if ctx := s.context(ev); ctx != nil {
+					incoming <- ctx
+				}
+
+			case *slack.InvalidAuthEvent:
+				return errors.New("invalid credentials")
+			}
+		}
+	}
+}
+
+// context creates a Context given the crap we get from Slack; channels and
+// users that have turned up since the names were loaded are looked up as
+// they're seen
+func (s *slackMessenger) context(ev *slack.MessageEvent) *Context {
+	// bot messages (including our own) don't have a user
+	if ev.User == "" {
+		return nil
+	}
+
+	channel := s.channelName(ev.Channel)
+	user := s.userName(ev.User)
+	if channel == "" || user == "" {
+		return nil
+	}
+
+	return &Context{
+		Channel: channel,
+		User:    user,
+		Text:    ev.Text,
+		Chat:    s,
+		Thread:  ev.ThreadTimestamp,
+		Message: ev.Timestamp,
+	}
+}
+
+// channelName is the name of the channel with an ID, looked up if it's
+// new; "" if there's no such channel
+func (s *slackMessenger) channelName(id string) string {
+	if name, ok := s.name(s.channels, id); ok {
+		return name
+	}
+
+	ch, err := s.api.GetConversationInfo(id, false)
+	if err != nil {
+		log.Printf("can't find channel with id %s: %s", id, err)
+		return ""
+	}
+	s.setName(s.channels, id, ch.Name)
+	return ch.Name
+}
+
+// userName is the name of the user with an ID, looked up if they're new;
+// "" if there's no such user
+func (s *slackMessenger) userName(id string) string {
+	if name, ok := s.name(s.users, id); ok {
+		return name
+	}
+
+	user, err := s.api.GetUserInfo(id)
+	if err != nil {
+		log.Printf("can't find user with id %s: %s", id, err)
+		return ""
+	}
+	s.setName(s.users, id, user.Name)
+	return user.Name
+}
+
+// channelID is what the API calls that want an ID get for a channel
+func (s *slackMessenger) channelID(name string) string {
+	if id := s.id(s.channels, name); id != "" {
+		return id
+	}
+	return "#" + name
+}
+
+func (s *slackMessenger) Post(channel, thread, text string) (string, error) {
+	_, ts, err := s.api.PostMessage(s.channelID(channel), text, slack.PostMessageParameters{
+		AsUser:          true,
+		ThreadTimestamp: thread,
+	})
+	return ts, err
+}
+
+func (s *slackMessenger) PostLink(channel, thread, url, title, text string) error {
+	_, _, err := s.api.PostMessage(s.channelID(channel), text, slack.PostMessageParameters{
+		AsUser:          true,
+		ThreadTimestamp: thread,
+		Attachments: []slack.Attachment{
+			{
+				Title:    title,
+				ImageURL: url,
+			},
+		},
+	})
+	return err
+}
+
+func (s *slackMessenger) PostImage(channel, thread string, img image.Image, title, text string) error {
+	buf := &bytes.Buffer{}
+	if err := png.Encode(buf, img); err != nil {
+		return err
+	}
+
+	_, err := s.api.UploadFile(slack.FileUploadParameters{
+		Reader:          buf,
+		Filename:        "board.png",
+		Filetype:        "png",
+		Title:           title,
+		InitialComment:  text,
+		Channels:        []string{s.channelID(channel)},
+		ThreadTimestamp: thread,
+	})
+	return err
+}
+
+func (s *slackMessenger) React(channel, message, emoji string) error {
+	return s.api.AddReaction(emoji, slack.NewRefToMessage(s.channelID(channel), message))
+}
+
+func (s *slackMessenger) DirectMessage(user, text string) error {
+	id := s.id(s.users, user)
+	if id == "" {
+		return fmt.Errorf("can't find user named %s", user)
+	}
+
+	_, _, channel, err := s.api.OpenIMChannel(id)
+	if err != nil {
+		return err
+	}
+
+	_, _, err = s.api.PostMessage(channel, text, slack.PostMessageParameters{
+		AsUser: true,
+	})
+	return err
+}
+
+func (s *slackMessenger) HasChannel(channel string) bool {
+	return s.id(s.channels, channel) != ""
+}
+
+// slackChannelRx is a channel in a message: Slack links them as
+// "<#C024BE7LR|name>" (sometimes without the name), but people can still
+// type "#name" where Slack doesn't
+var slackChannelRx = regexp.MustCompile(`<#([A-Z0-9]+)(?:\|([^>]*))?>|#([\w-]+)`)
+
+func (s *slackMessenger) ParseChannels(text string) []string {
+	ret := []string{}
+	for _, m := range slackChannelRx.FindAllStringSubmatch(text, -1) {
+		name := m[2] + m[3]
+		if name == "" {
+			name = s.channelName(m[1])
+		}
+		if name != "" {
+			ret = append(ret, name)
+		}
+	}
+	return ret
+}
+
+// slackUserRx is a mention, "<@U024BE7LH>" or "<@U024BE7LH|name>"
+var slackUserRx = regexp.MustCompile(`^<@([A-Z0-9]+)(?:\|[^>]*)?>$`)
+
+func (s *slackMessenger) ParseUser(word string) string {
+	if m := slackUserRx.FindStringSubmatch(word); m != nil {
+		if name := s.userName(m[1]); name != "" {
+			return name
+		}
+		return word
+	}
+	return strings.TrimPrefix(word, "@")
+}
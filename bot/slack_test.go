@@ -0,0 +1,178 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeSlack is enough of Slack's web API for the messenger: two pages of
+// channels, some users, and whatever's posted, by API method
+type fakeSlack struct {
+	*httptest.Server
+
+	lock  sync.Mutex
+	calls map[string][]url.Values
+}
+
+func newFakeSlack(t *testing.T) *fakeSlack {
+	f := &fakeSlack{calls: map[string][]url.Values{}}
+
+	mux := http.NewServeMux()
+	reply := map[string]func(r *http.Request) string{
+		"conversations.list": func(r *http.Request) string {
+			if r.FormValue("cursor") == "" {
+				return `"channels":[{"id":"C1","name":"chess"},{"id":"C2","name":"general"}],"response_metadata":{"next_cursor":"page2"}`
+			}
+			return `"channels":[{"id":"G3","name":"secret-chess"}],"response_metadata":{"next_cursor":""}`
+		},
+		"users.list": func(r *http.Request) string {
+			return `"members":[{"id":"U1","name":"alice"},{"id":"U2","name":"bob"}]`
+		},
+		"chat.postMessage": func(r *http.Request) string {
+			return fmt.Sprintf(`"channel":%q,"ts":"1500000000.000100"`, r.FormValue("channel"))
+		},
+		"files.upload": func(r *http.Request) string {
+			return `"file":{"id":"F1"}`
+		},
+		"users.info": func(r *http.Request) string {
+			return fmt.Sprintf(`"user":{"id":%q,"name":"carol"}`, r.FormValue("user"))
+		},
+		"conversations.info": func(r *http.Request) string {
+			return fmt.Sprintf(`"channel":{"id":%q,"name":"new-chess"}`, r.FormValue("channel"))
+		},
+	}
+
+	for method, fn := range reply {
+		method, fn := method, fn
+		mux.HandleFunc("/"+method, func(w http.ResponseWriter, r *http.Request) {
+			if err := r.ParseMultipartForm(1 << 20); err != nil && err != http.ErrNotMultipart {
+				t.Errorf("%s: %s", method, err)
+			}
+
+			f.lock.Lock()
+			f.calls[method] = append(f.calls[method], r.Form)
+			f.lock.Unlock()
+
+			fmt.Fprintf(w, `{"ok":true,%s}`, fn(r))
+		})
+	}
+
+	f.Server = httptest.NewServer(mux)
+	return f
+}
+
+// called is what the bot sent to an API method, in order
+func (f *fakeSlack) called(method string) []url.Values {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	return f.calls[method]
+}
+
+// messenger is a Slack messenger talking to the fake, with its names
+// loaded as they would be when it starts running
+func (f *fakeSlack) messenger(t *testing.T) *slackMessenger {
+	s := newSlackMessenger("xoxb-test", f.URL+"/")
+	if err := s.loadNames(); err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestSlackLoadNames(t *testing.T) {
+	f := newFakeSlack(t)
+	defer f.Close()
+	s := f.messenger(t)
+
+	for _, channel := range []string{"chess", "general", "secret-chess"} {
+		if !s.HasChannel(channel) {
+			t.Errorf("didn't find #%s", channel)
+		}
+	}
+	if s.HasChannel("random") {
+		t.Error("found a channel that isn't there")
+	}
+
+	if id := s.id(s.users, "bob"); id != "U2" {
+		t.Errorf("bob is %q", id)
+	}
+}
+
+func TestSlackPost(t *testing.T) {
+	f := newFakeSlack(t)
+	defer f.Close()
+	s := f.messenger(t)
+
+	if ts, err := s.Post("secret-chess", "1499999999.000200", "e2 e4"); err != nil || ts != "1500000000.000100" {
+		t.Fatalf("posted %q: %v", ts, err)
+	}
+	if err := s.PostLink("chess", "", "http://example.com/board.png", "Board", "e7 e5"); err != nil {
+		t.Fatal(err)
+	}
+
+	posts := f.called("chat.postMessage")
+	if len(posts) != 2 {
+		t.Fatalf("%d posts", len(posts))
+	}
+
+	if posts[0].Get("channel") != "G3" || posts[0].Get("thread_ts") != "1499999999.000200" || posts[0].Get("text") != "e2 e4" {
+		t.Errorf("post went to %s", posts[0].Encode())
+	}
+	if posts[1].Get("channel") != "C1" || posts[1].Get("thread_ts") != "" {
+		t.Errorf("link went to %s", posts[1].Encode())
+	}
+}
+
+func TestSlackPostImage(t *testing.T) {
+	f := newFakeSlack(t)
+	defer f.Close()
+	s := f.messenger(t)
+
+	img := image.NewRGBA(image.Rect(0, 0, 8, 8))
+	if err := s.PostImage("secret-chess", "1499999999.000200", img, "Board", "White moves"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.PostImage("chess", "", img, "Board", "Black moves"); err != nil {
+		t.Fatal(err)
+	}
+
+	uploads := f.called("files.upload")
+	if len(uploads) != 2 {
+		t.Fatalf("%d uploads", len(uploads))
+	}
+
+	if uploads[0].Get("channels") != "G3" || uploads[0].Get("thread_ts") != "1499999999.000200" || uploads[0].Get("initial_comment") != "White moves" {
+		t.Errorf("board went to %s", uploads[0].Encode())
+	}
+	if uploads[1].Get("channels") != "C1" || uploads[1].Get("thread_ts") != "" {
+		t.Errorf("board went to %s", uploads[1].Encode())
+	}
+}
+
+func TestSlackParse(t *testing.T) {
+	f := newFakeSlack(t)
+	defer f.Close()
+	s := f.messenger(t)
+
+	channels := s.ParseChannels("chess tournament spring boards <#C1|chess> <#G3> #general <#C9>, and #chess-2")
+	if want := []string{"chess", "secret-chess", "general", "new-chess", "chess-2"}; strings.Join(channels, " ") != strings.Join(want, " ") {
+		t.Errorf("channels are %q, not %q", channels, want)
+	}
+
+	for word, want := range map[string]string{
+		"<@U2>":       "bob",
+		"<@U1|alice>": "alice",
+		"<@U7>":       "carol",
+		"@bob":        "bob",
+		"dave":        "dave",
+	} {
+		if user := s.ParseUser(word); user != want {
+			t.Errorf("%s is %q, not %q", word, user, want)
+		}
+	}
+}
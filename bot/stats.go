@@ -0,0 +1,202 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+
+	"github.com/tqbf/chess"
+)
+
+// Per-player statistics from the archive, for settling arguments. Games
+// against yourself don't count.
+
+// record is wins, losses and draws
+type record struct {
+	Won, Lost, Drawn int
+}
+
+func (r *record) add(score float64) {
+	switch score {
+	case 1:
+		r.Won++
+	case 0:
+		r.Lost++
+	default:
+		r.Drawn++
+	}
+}
+
+func (r record) games() int {
+	return r.Won + r.Lost + r.Drawn
+}
+
+func (r record) String() string {
+	return fmt.Sprintf("+%d -%d =%d", r.Won, r.Lost, r.Drawn)
+}
+
+// sanMoves works out an archived game's moves in SAN from its boards,
+// stopping at the first one that isn't a legal move (an edited board)
+func sanMoves(a *ArchivedGame) []string {
+	if len(a.Boards) == 0 {
+		return nil
+	}
+
+	p := chess.PositionFromBoard(a.Boards[0], true)
+	if a.Boards[0].Normalize() == chess.StartingBoard.Normalize() {
+		p = chess.StartingPosition(chess.VARIANT_STANDARD)
+	}
+
+	ret := []string{}
+	for _, next := range a.Boards[1:] {
+		move, err := p.InferMove(next)
+		if err != nil {
+			break
+		}
+
+		san, _ := p.SAN(move)
+		ret = append(ret, san)
+		p, _ = p.Play(move)
+	}
+	return ret
+}
+
+// counted is a name and how often it came up
+type counted struct {
+	Name  string
+	Count int
+}
+
+// mostCommon sorts counts, biggest first, keeping the first n
+func mostCommon(counts map[string]int, n int) []counted {
+	ret := []counted{}
+	for name, count := range counts {
+		ret = append(ret, counted{name, count})
+	}
+
+	sort.Slice(ret, func(i, j int) bool {
+		if ret[i].Count != ret[j].Count {
+			return ret[i].Count > ret[j].Count
+		}
+		return ret[i].Name < ret[j].Name
+	})
+
+	if len(ret) > n {
+		ret = ret[:n]
+	}
+	return ret
+}
+
+// playerStats reports everything the archive knows about a player
+func playerStats(archive []*ArchivedGame, player string) string {
+	me := ratingKey(player)
+
+	var asWhite, asBlack record
+	plies, games := 0, 0
+	streak, longest := 0, 0
+	openings := map[string]int{}
+	firstMoves := [2]map[string]int{{}, {}}
+	h2h := map[string]*record{}
+
+	for _, a := range archive {
+		white, black := ratingKey(a.White), ratingKey(a.Black)
+		if (white != me && black != me) || white == black {
+			continue
+		}
+
+		var score float64
+		switch a.Result {
+		case "1-0":
+			score = 1
+		case "0-1":
+			score = 0
+		case "1/2-1/2":
+			score = 0.5
+		default:
+			continue
+		}
+
+		side, opponent := 0, a.Black
+		if black == me {
+			side, opponent, score = 1, a.White, 1-score
+		}
+
+		if side == 0 {
+			asWhite.add(score)
+		} else {
+			asBlack.add(score)
+		}
+
+		if h2h[ratingKey(opponent)] == nil {
+			h2h[ratingKey(opponent)] = &record{}
+		}
+		h2h[ratingKey(opponent)].add(score)
+
+		if score == 1 {
+			streak++
+			if streak > longest {
+				longest = streak
+			}
+		} else {
+			streak = 0
+		}
+
+		games++
+		plies += len(a.Moves)
+
+		moves := sanMoves(a)
+		if len(moves) >= 2 {
+			openings[chess.FindOpening(moves).String()]++
+		}
+		if len(moves) > side {
+			firstMoves[side][moves[side]]++
+		}
+	}
+
+	if games == 0 {
+		return ""
+	}
+
+	out := &bytes.Buffer{}
+	total := record{asWhite.Won + asBlack.Won, asWhite.Lost + asBlack.Lost, asWhite.Drawn + asBlack.Drawn}
+	fmt.Fprintf(out, "*%s*: %d games, %s\n", player, games, total)
+	fmt.Fprintf(out, "As white: %s; as black: %s\n", asWhite, asBlack)
+	fmt.Fprintf(out, "Average game: %.1f moves\n", float64(plies)/float64(games)/2)
+	fmt.Fprintf(out, "Longest winning streak: %d\n", longest)
+
+	if top := mostCommon(openings, 3); len(top) > 0 {
+		fmt.Fprintf(out, "Favourite openings:")
+		for i, o := range top {
+			if i > 0 {
+				fmt.Fprintf(out, ",")
+			}
+			fmt.Fprintf(out, " %s (%d)", o.Name, o.Count)
+		}
+		fmt.Fprintf(out, "\n")
+	}
+
+	for side, name := range []string{"white", "black"} {
+		if top := mostCommon(firstMoves[side], 1); len(top) > 0 {
+			fmt.Fprintf(out, "Most common first move as %s: %s (%d of %d)\n", name, top[0].Name, top[0].Count, []record{asWhite, asBlack}[side].games())
+		}
+	}
+
+	opponents := []string{}
+	for opponent := range h2h {
+		opponents = append(opponents, opponent)
+	}
+	sort.Slice(opponents, func(i, j int) bool {
+		if h2h[opponents[i]].games() != h2h[opponents[j]].games() {
+			return h2h[opponents[i]].games() > h2h[opponents[j]].games()
+		}
+		return opponents[i] < opponents[j]
+	})
+
+	fmt.Fprintf(out, "Head to head:\n")
+	for _, opponent := range opponents {
+		r := h2h[opponent]
+		fmt.Fprintf(out, "  vs %s: %s (%.1f/%d)\n", opponent, r, float64(r.Won)+float64(r.Drawn)/2, r.games())
+	}
+
+	return out.String()
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/tqbf/chess"
+)
+
+// archived is a finished game of moves (in SAN) from the starting position
+func archived(t *testing.T, id int, white, black, result, moves string) *ArchivedGame {
+	a := &ArchivedGame{ID: id, Channel: "chess", White: white, Black: black, Result: result}
+
+	p := chess.StartingPosition(chess.VARIANT_STANDARD)
+	a.Boards = append(a.Boards, p.Board)
+	for _, san := range strings.Fields(moves) {
+		move, err := p.ParseSAN(san)
+		if err != nil {
+			t.Fatalf("game %d: %s", id, err)
+		}
+		p, _ = p.Play(move)
+		a.Boards = append(a.Boards, p.Board)
+		a.Moves = append(a.Moves, san)
+	}
+	return a
+}
+
+func TestPlayerStats(t *testing.T) {
+	archive := []*ArchivedGame{
+		archived(t, 1, "alice", "bob", "1-0", "e4 e5 Nf3 Nc6 Bb5"),
+		archived(t, 2, "bob", "alice", "0-1", "d4 d5 c4"),
+		archived(t, 3, "alice", "carol", "1-0", "e4 c5"),
+		// games against yourself don't count, or break a streak
+		archived(t, 4, "alice", "@Alice", "0-1", "f4"),
+		archived(t, 5, "carol", "alice", "1-0", "e4 e6"),
+		archived(t, 6, "alice", "@Bob", "1/2-1/2", "e4 e5 Nf3 Nc6 Bb5"),
+		// nor do unfinished ones
+		archived(t, 7, "alice", "bob", "*", "b3"),
+	}
+
+	want := `*alice*: 5 games, +3 -1 =1
+As white: +2 -0 =1; as black: +1 -1 =0
+Average game: 1.7 moves
+Longest winning streak: 3
+Favourite openings: C60 Ruy Lopez (2), B20 Sicilian Defense (1), C00 French Defense (1)
+Most common first move as white: e4 (3 of 3)
+Most common first move as black: d5 (1 of 2)
+Head to head:
+  vs bob: +2 -0 =1 (2.5/3)
+  vs carol: +1 -1 =0 (1.0/2)
+`
+	if got := playerStats(archive, "alice"); got != want {
+		t.Errorf("stats are\n%s\nnot\n%s", got, want)
+	}
+
+	if got := playerStats(archive, "dave"); got != "" {
+		t.Errorf("dave has stats: %s", got)
+	}
+}
+
+func TestSANMoves(t *testing.T) {
+	a := archived(t, 1, "alice", "bob", "1-0", "e4 e5 Qh5 Nc6 Bc4 Nf6 Qxf7#")
+	if got := strings.Join(sanMoves(a), " "); got != "e4 e5 Qh5 Nc6 Bc4 Nf6 Qxf7#" {
+		t.Errorf("moves are %q", got)
+	}
+
+	// an edited board stops the moves there
+	a.Boards[3] = a.Boards[3].Replace('_', 0)
+	if got := strings.Join(sanMoves(a), " "); got != "e4 e5" {
+		t.Errorf("moves after an edit are %q", got)
+	}
+
+	if sanMoves(&ArchivedGame{}) != nil {
+		t.Error("a game without boards has moves")
+	}
+}
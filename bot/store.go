@@ -0,0 +1,364 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/tqbf/chess"
+)
+
+// Saving games, so a restart doesn't throw away everyone's games. Each
+// game is saved after every command it handles.
+//
+// Games are kept in plain JSON files rather than SQLite or an embedded
+// key-value store: the bot saves one small game at a time, which a rename
+// makes atomic, and never queries across games except for the archive,
+// which is read whole anyway. Files avoid cgo and new dependencies, and
+// can be read and fixed by hand. Store is the seam for anything else.
+
+// Store is somewhere games can be saved between runs of the bot
+type Store interface {
+	// Load returns every saved game, by gameKey
+	Load() (map[string]*Game, error)
+
+	// Save saves (or replaces) a game, by gameKey
+	Save(key string, game *Game) error
+
+	// Delete forgets a game
+	Delete(key string) error
+
+	// Archive saves a finished game, giving it an ID if it doesn't have
+	// one and replacing the earlier copy if it does
+	Archive(a *ArchivedGame) error
+
+	// Archived returns every archived game, oldest first
+	Archived() ([]*ArchivedGame, error)
+
+	// SaveTournament saves (or replaces) a tournament
+	SaveTournament(t *Tournament) error
+
+	// Tournaments returns every saved tournament, by tournamentKey
+	Tournaments() (map[string]*Tournament, error)
+}
+
+// schemaVersion is the version of the saved game format. Bump it when Game
+// changes in a way old files can't just be loaded into, and add a
+// migration.
+const schemaVersion = 1
+
+// migrations[i] upgrades a saved game from version i+1 to i+2, working on
+// the raw JSON so it can rename and reshape fields
+var migrations = []func(map[string]json.RawMessage) error{}
+
+// savedGame is what a game looks like on disk; the game tree is saved from
+// its root, with the path to the current node, since the nodes point at
+// each other
+type savedGame struct {
+	Version int
+	Channel string // the gameKey, which for games before threads was the channel
+	Game    *Game
+	Tree    *chess.Node
+	Line    []int
+}
+
+// FileStore keeps each channel's game as a JSON file in a directory
+type FileStore struct {
+	Dir string
+}
+
+// NewFileStore returns a FileStore in dir, creating it if it needs to
+func NewFileStore(dir string) (*FileStore, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	return &FileStore{Dir: dir}, nil
+}
+
+func (fs *FileStore) path(key string) string {
+	return filepath.Join(fs.Dir, url.PathEscape(key)+".json")
+}
+
+// Load reads every game in the directory; files that can't be read are
+// logged and skipped, so one bad game doesn't lose the rest
+func (fs *FileStore) Load() (map[string]*Game, error) {
+	files, err := filepath.Glob(filepath.Join(fs.Dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+
+	ret := map[string]*Game{}
+	for _, fn := range files {
+		saved, err := loadGame(fn)
+		if err != nil {
+			log.Printf("can't load game from %s: %s", fn, err)
+			continue
+		}
+
+		game := saved.Game
+		if saved.Tree != nil {
+			game.Line = saved.Tree.Follow(saved.Line)
+		}
+		ret[saved.Channel] = game
+	}
+
+	return ret, nil
+}
+
+func loadGame(fn string) (*savedGame, error) {
+	buf, err := ioutil.ReadFile(fn)
+	if err != nil {
+		return nil, err
+	}
+
+	raw := map[string]json.RawMessage{}
+	if err = json.Unmarshal(buf, &raw); err != nil {
+		return nil, err
+	}
+
+	version := 0
+	if err = json.Unmarshal(raw["Version"], &version); err != nil {
+		return nil, fmt.Errorf("no schema version: %s", err)
+	}
+
+	if version < 1 || version > schemaVersion {
+		return nil, fmt.Errorf("schema version %d, but I only know up to %d", version, schemaVersion)
+	}
+
+	for ; version < schemaVersion; version++ {
+		if err = migrations[version-1](raw); err != nil {
+			return nil, fmt.Errorf("upgrading from schema version %d: %s", version, err)
+		}
+	}
+
+	if buf, err = json.Marshal(raw); err != nil {
+		return nil, err
+	}
+
+	saved := &savedGame{}
+	if err = json.Unmarshal(buf, saved); err != nil {
+		return nil, err
+	}
+
+	if saved.Game == nil {
+		return nil, fmt.Errorf("no game")
+	}
+
+	return saved, nil
+}
+
+// Save writes the game out as JSON
+func (fs *FileStore) Save(key string, game *Game) error {
+	saved := savedGame{
+		Version: schemaVersion,
+		Channel: key,
+		Game:    game,
+	}
+
+	if game.Line != nil {
+		saved.Tree = game.Line.Root()
+		saved.Line = game.Line.Path()
+	}
+
+	return writeJSON(fs.path(key), saved)
+}
+
+// writeJSON writes to a temporary file and renames it into place, so a
+// crash halfway through leaves the old file
+func writeJSON(fn string, v interface{}) error {
+	buf, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Dir(fn), ".save-")
+	if err != nil {
+		return err
+	}
+
+	if _, err = tmp.Write(buf); err == nil {
+		err = tmp.Close()
+	} else {
+		tmp.Close()
+	}
+
+	if err == nil {
+		err = os.Rename(tmp.Name(), fn)
+	}
+
+	if err != nil {
+		os.Remove(tmp.Name())
+	}
+	return err
+}
+
+// Delete removes a game's file
+func (fs *FileStore) Delete(key string) error {
+	err := os.Remove(fs.path(key))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+// savedArchive is an archived game on disk
+type savedArchive struct {
+	Version int
+	Game    *ArchivedGame
+}
+
+func (fs *FileStore) archiveDir() string {
+	return filepath.Join(fs.Dir, "archive")
+}
+
+// Archive writes a finished game to archive/ID.json, numbering new games
+// one past the highest so far
+func (fs *FileStore) Archive(a *ArchivedGame) error {
+	if err := os.MkdirAll(fs.archiveDir(), 0755); err != nil {
+		return err
+	}
+
+	if a.ID == 0 {
+		all, err := fs.Archived()
+		if err != nil {
+			return err
+		}
+
+		a.ID = 1
+		if len(all) > 0 {
+			a.ID = all[len(all)-1].ID + 1
+		}
+	}
+
+	return writeJSON(filepath.Join(fs.archiveDir(), fmt.Sprintf("%d.json", a.ID)), savedArchive{
+		Version: schemaVersion,
+		Game:    a,
+	})
+}
+
+// Archived reads every file in archive/
+func (fs *FileStore) Archived() ([]*ArchivedGame, error) {
+	files, err := filepath.Glob(filepath.Join(fs.archiveDir(), "*.json"))
+	if err != nil {
+		return nil, err
+	}
+
+	ret := []*ArchivedGame{}
+	for _, fn := range files {
+		if _, err := strconv.Atoi(strings.TrimSuffix(filepath.Base(fn), ".json")); err != nil {
+			continue
+		}
+
+		buf, err := ioutil.ReadFile(fn)
+		if err != nil {
+			return nil, err
+		}
+
+		saved := savedArchive{}
+		if err = json.Unmarshal(buf, &saved); err != nil || saved.Game == nil {
+			log.Printf("can't load archived game from %s: %v", fn, err)
+			continue
+		}
+		if saved.Version > schemaVersion {
+			log.Printf("can't load archived game from %s: schema version %d", fn, saved.Version)
+			continue
+		}
+
+		ret = append(ret, saved.Game)
+	}
+
+	sort.Slice(ret, func(i, j int) bool {
+		return ret[i].ID < ret[j].ID
+	})
+	return ret, nil
+}
+
+// savedTournament is a tournament on disk
+type savedTournament struct {
+	Version    int
+	Tournament *Tournament
+}
+
+func (fs *FileStore) tournamentDir() string {
+	return filepath.Join(fs.Dir, "tournaments")
+}
+
+// SaveTournament writes a tournament to tournaments/name.json
+func (fs *FileStore) SaveTournament(t *Tournament) error {
+	if err := os.MkdirAll(fs.tournamentDir(), 0755); err != nil {
+		return err
+	}
+
+	return writeJSON(filepath.Join(fs.tournamentDir(), url.PathEscape(tournamentKey(t.Name))+".json"), savedTournament{
+		Version:    schemaVersion,
+		Tournament: t,
+	})
+}
+
+// Tournaments reads every file in tournaments/
+func (fs *FileStore) Tournaments() (map[string]*Tournament, error) {
+	files, err := filepath.Glob(filepath.Join(fs.tournamentDir(), "*.json"))
+	if err != nil {
+		return nil, err
+	}
+
+	ret := map[string]*Tournament{}
+	for _, fn := range files {
+		buf, err := ioutil.ReadFile(fn)
+		if err != nil {
+			return nil, err
+		}
+
+		saved := savedTournament{}
+		if err = json.Unmarshal(buf, &saved); err != nil || saved.Tournament == nil || saved.Version > schemaVersion {
+			log.Printf("can't load tournament from %s: %v", fn, err)
+			continue
+		}
+
+		ret[tournamentKey(saved.Tournament.Name)] = saved.Tournament
+	}
+	return ret, nil
+}
+
+// store is where games are saved; nil means they aren't
+var store Store
+
+// saveGame saves a game (by gameKey), if there's a store; failures are
+// only logged, since there's nothing better to do about them mid-game
+func saveGame(key string) {
+	if store == nil {
+		return
+	}
+
+	game, ok := games[key]
+	if !ok {
+		return
+	}
+
+	// a thread gets a game once someone sets one up, but there's no need
+	// to keep the ones nobody's playing
+	if _, thread := splitKey(key); thread != "" && game.White == "" && game.Black == "" && len(game.Moves) == 0 {
+		return
+	}
+
+	// nor the ones that are over, once they're in the archive; a channel's
+	// own game stays until it's reset, since it also holds whether chess
+	// is allowed there
+	if _, thread := splitKey(key); thread != "" && game.over() && game.ArchiveID != 0 {
+		if err := store.Delete(key); err != nil {
+			log.Printf("can't delete finished game in %s: %s", key, err)
+		}
+		return
+	}
+
+	if err := store.Save(key, game); err != nil {
+		log.Printf("can't save game in %s: %s", key, err)
+	}
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tqbf/chess"
+)
+
+func TestSaveFinishedThreadGame(t *testing.T) {
+	fs := tempStore(t)
+	store = fs
+	defer func() { store = nil }()
+
+	channel, thread := "chess", gameKey("chess", "1234.5678")
+	games = map[string]*Game{
+		channel: newGame(),
+		thread:  newGame(),
+	}
+	games[thread].White, games[thread].Black = "alice", "bob"
+
+	saveGame(channel)
+	saveGame(thread)
+
+	saved, err := fs.Load()
+	if err != nil || saved[channel] == nil || saved[thread] == nil {
+		t.Fatalf("saved %v (%v)", saved, err)
+	}
+
+	// once both games are over and archived, the thread's is forgotten
+	for _, key := range []string{channel, thread} {
+		games[key].Winner = "bob"
+		games[key].ArchiveID = 1
+		saveGame(key)
+	}
+
+	saved, err = fs.Load()
+	if err != nil || saved[channel] == nil || saved[thread] != nil {
+		t.Fatalf("saved %v (%v)", saved, err)
+	}
+}
+
+// tempStore is a FileStore in a directory that goes away after the test
+func tempStore(t *testing.T) *FileStore {
+	dir, err := ioutil.TempDir("", "chessbot")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	fs, err := NewFileStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return fs
+}
+
+func TestSaveLoad(t *testing.T) {
+	fs := tempStore(t)
+
+	game := newGame()
+	game.White, game.Black = "alice", "bob"
+	game.Allowed = true
+
+	tc, _ := chess.ParseTimeControl("40/90,30+30")
+	game.Clock = chess.NewClock(tc)
+	game.Clock.Start(time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC))
+
+	// a move, an edit, and a line that was taken back
+	p := chess.StartingPosition(chess.VARIANT_STANDARD)
+	root := chess.NewGame(p)
+	e4, _ := root.Play("e4")
+	root.Play("d4")
+	game.Line = e4
+
+	game.Previous = []chess.Board{p.Board, e4.Position.Board}
+	game.Moves = []string{"e4", editMark + "Cleared the board."}
+	game.Board = chess.Board(strings.Repeat("_", 64))
+	game.EditedWhite = map[int]bool{1: false}
+	game.EditedCastling = map[int]string{1: ""}
+
+	key := gameKey("chess", "1234.5678")
+	if err := fs.Save(key, game); err != nil {
+		t.Fatal(err)
+	}
+
+	saved, err := fs.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	loaded := saved[key]
+	if loaded == nil {
+		t.Fatalf("loaded %v", saved)
+	}
+
+	if loaded.Line == nil || loaded.Line.Move != "e4" || len(loaded.Line.Root().Children) != 2 || loaded.Line.Root().Children[1].Move != "d4" {
+		t.Errorf("game tree came back as %+v", loaded.Line)
+	}
+
+	// the tree's checked above, and points back at itself
+	loaded.Line, game.Line = nil, nil
+	if !reflect.DeepEqual(loaded, game) {
+		t.Errorf("saved\n%+v\nloaded\n%+v", game, loaded)
+	}
+}
+
+func TestLoadVersions(t *testing.T) {
+	fs := tempStore(t)
+
+	if err := fs.Save("chess", newGame()); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, body := range map[string]string{
+		"zero":    `{"Version":0,"Channel":"zero","Game":{}}`,
+		"future":  `{"Version":99,"Channel":"future","Game":{}}`,
+		"none":    `{"Channel":"none","Game":{}}`,
+		"no-game": `{"Version":1,"Channel":"no-game"}`,
+		"garbage": `{"Version":1,`,
+	} {
+		fn := filepath.Join(fs.Dir, name+".json")
+		if err := ioutil.WriteFile(fn, []byte(body), 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := loadGame(fn); err == nil {
+			t.Errorf("loaded %s", body)
+		}
+	}
+
+	// the bad files are skipped, and the good one still loads
+	saved, err := fs.Load()
+	if err != nil || len(saved) != 1 || saved["chess"] == nil {
+		t.Errorf("loaded %v (%v)", saved, err)
+	}
+}
@@ -0,0 +1,623 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+
+	"github.com/tqbf/chess"
+)
+
+// Tournaments: Swiss (paired a round at a time by score, never the same
+// pairing twice) or round-robin (everyone plays everyone, from Berger
+// tables). Games are played in threads in the tournament's channel, or, if
+// it has board channels, in those, as many at once as there are boards;
+// pairings wait for a free board, and start when one comes free.
+
+// Tournament formats
+const (
+	swiss      = "swiss"
+	roundRobin = "round-robin"
+)
+
+// Pairing is one game in a tournament. Black is "" for a bye, which counts
+// as a win.
+type Pairing struct {
+	Round        int
+	White, Black string
+
+	// Result is "1-0", "0-1", "1/2-1/2", or "" until the game's over
+	Result string
+
+	// Channel is the gameKey of the game, "" until it has a board
+	Channel string
+}
+
+// Tournament is a tournament and all its pairings so far
+type Tournament struct {
+	Name   string
+	Format string
+	Rounds int
+
+	// Control is the time control for every game, "" for untimed
+	Control string
+
+	// Channel is where the tournament was created, where standings go;
+	// Boards are the channels games are played in, if they aren't in
+	// threads
+	Channel string
+	Boards  []string
+
+	// Players are in the order they joined, which is also their seeding
+	Players  []string
+	Round    int
+	Pairings []*Pairing
+	Finished bool
+}
+
+var tournaments = map[string]*Tournament{}
+
+func tournamentKey(name string) string {
+	return strings.ToLower(name)
+}
+
+// saveTournament saves a tournament, if there's a store
+func saveTournament(t *Tournament) {
+	if store == nil {
+		return
+	}
+
+	if err := store.SaveTournament(t); err != nil {
+		log.Printf("can't save tournament %s: %s", t.Name, err)
+	}
+}
+
+// score is how many points a player has in a pairing, and whether they
+// played in it
+func (p *Pairing) score(player string) (float64, bool) {
+	switch {
+	case p.Result == "":
+		return 0, false
+	case p.White == player && p.Black == "":
+		return 1, true
+	case p.Result == "1/2-1/2" && (p.White == player || p.Black == player):
+		return 0.5, true
+	case p.Result == "1-0" && p.White == player, p.Result == "0-1" && p.Black == player:
+		return 1, true
+	case p.White == player || p.Black == player:
+		return 0, true
+	}
+	return 0, false
+}
+
+// opponent is who player played in a pairing, "" for a bye or if they
+// weren't in it
+func (p *Pairing) opponent(player string) string {
+	switch player {
+	case p.White:
+		return p.Black
+	case p.Black:
+		return p.White
+	}
+	return ""
+}
+
+// scores adds up everyone's points
+func (t *Tournament) scores() map[string]float64 {
+	ret := map[string]float64{}
+	for _, player := range t.Players {
+		ret[player] = 0
+	}
+
+	for _, p := range t.Pairings {
+		for _, player := range []string{p.White, p.Black} {
+			if s, ok := p.score(player); ok {
+				ret[player] += s
+			}
+		}
+	}
+	return ret
+}
+
+// standing is one line of the standings table
+type standing struct {
+	Player          string
+	Score           float64
+	Buchholz        float64
+	SonnebornBerger float64
+}
+
+// standings ranks the players by score, then Buchholz (the sum of their
+// opponents' scores) and then Sonneborn-Berger (the scores of the opponents
+// they beat, and half of those they drew with); byes add nothing to either
+func (t *Tournament) standings() []standing {
+	scores := t.scores()
+
+	ret := []standing{}
+	for _, player := range t.Players {
+		s := standing{Player: player, Score: scores[player]}
+
+		for _, p := range t.Pairings {
+			opponent := p.opponent(player)
+			if opponent == "" {
+				continue
+			}
+
+			mine, played := p.score(player)
+			if !played {
+				continue
+			}
+
+			s.Buchholz += scores[opponent]
+			s.SonnebornBerger += mine * scores[opponent]
+		}
+
+		ret = append(ret, s)
+	}
+
+	sort.SliceStable(ret, func(i, j int) bool {
+		a, b := ret[i], ret[j]
+		if a.Score != b.Score {
+			return a.Score > b.Score
+		}
+		if a.Buchholz != b.Buchholz {
+			return a.Buchholz > b.Buchholz
+		}
+		return a.SonnebornBerger > b.SonnebornBerger
+	})
+	return ret
+}
+
+// played is true if two players have already been paired
+func (t *Tournament) played(a, b string) bool {
+	for _, p := range t.Pairings {
+		if (p.White == a && p.Black == b) || (p.White == b && p.Black == a) {
+			return true
+		}
+	}
+	return false
+}
+
+// colors returns how many more times a player has had white than black, and
+// the color they had last ("", "white" or "black")
+func (t *Tournament) colors(player string) (balance int, last string) {
+	for _, p := range t.Pairings {
+		switch {
+		case p.Black == "":
+		case p.White == player:
+			balance, last = balance+1, "white"
+		case p.Black == player:
+			balance, last = balance-1, "black"
+		}
+	}
+	return
+}
+
+// orient decides who gets white: whoever has had it less, then whoever had
+// black last, then the higher ranked (a)
+func (t *Tournament) orient(a, b string) (white, black string) {
+	ab, al := t.colors(a)
+	bb, bl := t.colors(b)
+
+	switch {
+	case ab > bb:
+		return b, a
+	case ab < bb:
+		return a, b
+	case al == "white" && bl != "white":
+		return b, a
+	}
+	return a, b
+}
+
+// swissRound pairs the next Swiss round: players are ranked by score (then
+// seed), the lowest ranked player without a bye sits out if there's an odd
+// number, and the rest are paired top down with the nearest player they
+// haven't met. If there's no way to avoid a rematch, rematches are allowed.
+func (t *Tournament) swissRound() []*Pairing {
+	scores := t.scores()
+
+	ranked := append([]string{}, t.Players...)
+	sort.SliceStable(ranked, func(i, j int) bool {
+		return scores[ranked[i]] > scores[ranked[j]]
+	})
+
+	ret := []*Pairing{}
+
+	if len(ranked)%2 == 1 {
+		bye := len(ranked) - 1
+		for i := len(ranked) - 1; i >= 0; i-- {
+			if !t.played(ranked[i], "") {
+				bye = i
+				break
+			}
+		}
+
+		ret = append(ret, &Pairing{Round: t.Round, White: ranked[bye], Result: "1-0"})
+		ranked = append(ranked[:bye:bye], ranked[bye+1:]...)
+	}
+
+	var pair func(left []string, rematches bool) ([][2]string, bool)
+	pair = func(left []string, rematches bool) ([][2]string, bool) {
+		if len(left) == 0 {
+			return nil, true
+		}
+
+		for i := 1; i < len(left); i++ {
+			if !rematches && t.played(left[0], left[i]) {
+				continue
+			}
+
+			rest := append(append([]string{}, left[1:i]...), left[i+1:]...)
+			if pairs, ok := pair(rest, rematches); ok {
+				return append([][2]string{{left[0], left[i]}}, pairs...), true
+			}
+		}
+		return nil, false
+	}
+
+	pairs, ok := pair(ranked, false)
+	if !ok {
+		pairs, _ = pair(ranked, true)
+	}
+
+	for _, p := range pairs {
+		white, black := t.orient(p[0], p[1])
+		ret = append(ret, &Pairing{Round: t.Round, White: white, Black: black})
+	}
+	return ret
+}
+
+// bergerRound pairs a round-robin round from the Berger tables: with n
+// players (plus a bye, if that's odd) the last player stays put, alternating
+// colors, and everyone else moves n/2 places along each round
+func (t *Tournament) bergerRound() []*Pairing {
+	players := append([]string{}, t.Players...)
+	if len(players)%2 == 1 {
+		players = append(players, "")
+	}
+
+	n := len(players)
+	m := n - 1
+	r := t.Round - 1
+	a := r * (n / 2) % m
+
+	pairs := [][2]string{}
+	if r%2 == 0 {
+		pairs = append(pairs, [2]string{players[a], players[n-1]})
+	} else {
+		pairs = append(pairs, [2]string{players[n-1], players[a]})
+	}
+
+	for i := 1; i < n/2; i++ {
+		pairs = append(pairs, [2]string{players[(a+i)%m], players[(a-i+m)%m]})
+	}
+
+	ret := []*Pairing{}
+	for _, p := range pairs {
+		switch {
+		case p[1] == "":
+			ret = append(ret, &Pairing{Round: t.Round, White: p[0], Result: "1-0"})
+		case p[0] == "":
+			ret = append(ret, &Pairing{Round: t.Round, White: p[1], Result: "1-0"})
+		default:
+			ret = append(ret, &Pairing{Round: t.Round, White: p[0], Black: p[1]})
+		}
+	}
+	return ret
+}
+
+// current returns the pairings in the current round
+func (t *Tournament) current() (ret []*Pairing) {
+	for _, p := range t.Pairings {
+		if p.Round == t.Round {
+			ret = append(ret, p)
+		}
+	}
+	return
+}
+
+// boardFree is true if a board channel can take a new tournament game:
+// nothing's going on there, or what's there is finished
+func (t *Tournament) boardFree(channel string) bool {
+	for _, p := range t.Pairings {
+		if p.Channel == channel && p.Result == "" {
+			return false
+		}
+	}
+
+	game, ok := games[channel]
+	return !ok || game.over() || (len(game.Moves) == 0 && game.Tournament == "")
+}
+
+// startGames puts waiting pairings on free boards, or in threads of their
+// own
+func (t *Tournament) startGames(ctx *Context) {
+	tc, _ := chess.ParseTimeControl(t.Control)
+	home := &Context{Channel: t.Channel, Chat: ctx.Chat}
+
+	for i, p := range t.Pairings {
+		if p.Round != t.Round || p.Result != "" || p.Channel != "" {
+			continue
+		}
+
+		boards := t.Boards
+		if len(boards) == 0 {
+			thread, err := home.StartThread("*%s*, round %d: %s vs %s", t.Name, t.Round, p.White, p.Black)
+			if err != nil {
+				log.Printf("can't start a thread for %s: %s", t.Name, err)
+				continue
+			}
+			boards = []string{thread.key()}
+		}
+
+		for _, channel := range boards {
+			if !t.boardFree(channel) {
+				continue
+			}
+
+			p.Channel = channel
+			game := &Game{
+				Board:        chess.StartingBoard.Normalize(),
+				White:        p.White,
+				Black:        p.Black,
+				PlayingWhite: true,
+				Allowed:      true,
+				Tournament:   t.Name,
+				Pairing:      i,
+			}
+			if t.Control != "" {
+				game.Clock = chess.NewClock(tc)
+			}
+
+			games[channel] = game
+			saveGame(channel)
+
+			board := contextForKey(ctx.Chat, channel)
+			board.DrawBoard(game.Board, false, game.Highlights, "%s, round %d: %s (white) vs %s (black). Both say _start_ when you're ready.",
+				t.Name, t.Round, p.White, p.Black)
+			break
+		}
+	}
+}
+
+// nextRound pairs and starts the next round, or finishes the tournament
+func (t *Tournament) nextRound(ctx *Context) {
+	home := &Context{Channel: t.Channel, Chat: ctx.Chat}
+
+	if t.Round >= t.Rounds {
+		t.Finished = true
+		home.Post("*%s* is over!\n%s", t.Name, t.table())
+		return
+	}
+
+	t.Round++
+	if t.Format == swiss {
+		t.Pairings = append(t.Pairings, t.swissRound()...)
+	} else {
+		t.Pairings = append(t.Pairings, t.bergerRound()...)
+	}
+
+	home.Post("*%s*, round %d of %d:\n%s", t.Name, t.Round, t.Rounds, t.describeRound())
+	t.startGames(ctx)
+}
+
+// result records a tournament game's result, starting waiting games on the
+// board it frees, and the next round once this one's done
+func (t *Tournament) result(ctx *Context, pairing int, result string) {
+	if pairing < 0 || pairing >= len(t.Pairings) {
+		return
+	}
+
+	p := t.Pairings[pairing]
+	if p.Result != "" {
+		// the game was kept going after it ended, and has ended again
+		p.Result = result
+		return
+	}
+	p.Result = result
+
+	home := &Context{Channel: t.Channel, Chat: ctx.Chat}
+	home.Post("*%s*, round %d: %s %s %s", t.Name, p.Round, p.White, p.Result, p.Black)
+
+	for _, p := range t.current() {
+		if p.Result == "" {
+			t.startGames(ctx)
+			saveTournament(t)
+			return
+		}
+	}
+
+	t.nextRound(ctx)
+	saveTournament(t)
+}
+
+// describeRound lists the current round's pairings
+func (t *Tournament) describeRound() string {
+	out := &bytes.Buffer{}
+	for i, p := range t.current() {
+		switch {
+		case p.Black == "":
+			fmt.Fprintf(out, "%d. %s has a bye\n", i+1, p.White)
+		case p.Result != "":
+			fmt.Fprintf(out, "%d. %s %s %s\n", i+1, p.White, p.Result, p.Black)
+		case p.Channel != "":
+			where := "in #" + p.Channel
+			if channel, thread := splitKey(p.Channel); thread != "" {
+				where = "in a thread in #" + channel
+			}
+			fmt.Fprintf(out, "%d. %s vs %s, %s\n", i+1, p.White, p.Black, where)
+		default:
+			fmt.Fprintf(out, "%d. %s vs %s, waiting for a board\n", i+1, p.White, p.Black)
+		}
+	}
+	return out.String()
+}
+
+// table writes the standings
+func (t *Tournament) table() string {
+	out := &bytes.Buffer{}
+	for i, s := range t.standings() {
+		fmt.Fprintf(out, "%d. *%s* %g (Buchholz %g, S-B %g)\n", i+1, s.Player, s.Score, s.Buchholz, s.SonnebornBerger)
+	}
+	return out.String()
+}
+
+// tournamentCommand handles everything starting "chess tournament"
+func (ctx *Context) tournamentCommand() {
+	text := strings.TrimSpace(ctx.Text)
+
+	switch {
+	case match("tournament\\s+create\\s+(\\S+)\\s+(swiss|round.?robin)", text):
+		tox := matches("tournament\\s+create\\s+(\\S+)\\s+(swiss|round.?robin)(\\s+([0-9]+)\\s+rounds?)?(\\s+(.+))?", text)
+		name := tox[1]
+
+		if _, ok := tournaments[tournamentKey(name)]; ok {
+			ctx.Post("There's already a tournament called %s.", name)
+			return
+		}
+
+		t := &Tournament{
+			Name:    name,
+			Format:  roundRobin,
+			Channel: ctx.Channel,
+		}
+
+		if strings.ToLower(tox[2]) == swiss {
+			t.Format = swiss
+			if tox[4] == "" {
+				ctx.Post("How many rounds? Like _chess tournament create %s swiss 5 rounds_.", name)
+				return
+			}
+			fmt.Sscanf(tox[4], "%d", &t.Rounds)
+			if t.Rounds < 1 {
+				ctx.Post("A Swiss tournament needs at least one round.")
+				return
+			}
+		}
+
+		if control := strings.TrimSpace(tox[6]); control != "" {
+			if _, err := chess.ParseTimeControl(control); err != nil {
+				ctx.Post("I don't understand that time control: %s", err)
+				return
+			}
+			t.Control = control
+		}
+
+		tournaments[tournamentKey(name)] = t
+		saveTournament(t)
+		ctx.Post("Created *%s* (%s). Say _chess tournament join %s_ to play; games will be played in threads here, unless you say _chess tournament %s boards #one #two_.",
+			name, t.Format, name, name)
+		return
+	}
+
+	tox := matches("tournament\\s+(?:(join|leave|start|boards|standings|pairings)\\s+)?(\\S+)", text)
+	if tox == nil {
+		ctx.Post("Which tournament?")
+		return
+	}
+
+	verb, name := strings.ToLower(tox[1]), tox[2]
+	if verb == "" {
+		// "chess tournament office-cup boards #a #b"
+		if more := matches("tournament\\s+\\S+\\s+(join|leave|start|boards|standings|pairings)\\b", text); more != nil {
+			verb = strings.ToLower(more[1])
+		}
+	}
+
+	t, ok := tournaments[tournamentKey(name)]
+	if !ok {
+		ctx.Post("I don't know a tournament called %s.", name)
+		return
+	}
+	defer saveTournament(t)
+
+	switch verb {
+	case "join", "leave":
+		if t.Round > 0 {
+			ctx.Post("%s has already started.", t.Name)
+			return
+		}
+
+		for i, player := range t.Players {
+			if player == ctx.User {
+				if verb == "leave" {
+					t.Players = append(t.Players[:i], t.Players[i+1:]...)
+					ctx.Post("Ok, %s has left %s.", ctx.User, t.Name)
+				} else {
+					ctx.Post("You're already in %s.", t.Name)
+				}
+				return
+			}
+		}
+
+		if verb == "leave" {
+			ctx.Post("You aren't in %s.", t.Name)
+			return
+		}
+
+		t.Players = append(t.Players, ctx.User)
+		ctx.Post("Ok, %s has joined %s; that's %d players.", ctx.User, t.Name, len(t.Players))
+
+	case "boards":
+		channels := ctx.Chat.ParseChannels(text)
+		if len(channels) == 0 {
+			ctx.Post("Which channels? Like _chess tournament %s boards #one #two_.", t.Name)
+			return
+		}
+
+		boards := []string{}
+		for _, ch := range channels {
+			if !ctx.Chat.HasChannel(ch) && ch != ctx.Channel {
+				ctx.Post("I don't know a channel called %s.", ch)
+				return
+			}
+			boards = append(boards, ch)
+		}
+
+		t.Boards = boards
+		ctx.Post("Ok, %s's games will be played in #%s.", t.Name, strings.Join(boards, ", #"))
+
+	case "start":
+		if t.Round > 0 {
+			ctx.Post("%s has already started.", t.Name)
+			return
+		}
+		if len(t.Players) < 2 {
+			ctx.Post("%s needs at least two players.", t.Name)
+			return
+		}
+
+		if t.Format == roundRobin {
+			t.Rounds = len(t.Players) - 1 + len(t.Players)%2
+		} else if t.Rounds > len(t.Players)-1 {
+			// a Swiss can't go on longer than it takes everyone to meet
+			// everyone, and pairing gets very slow trying
+			t.Rounds = len(t.Players) - 1
+			ctx.Post("With %d players, %s can only have %d rounds without rematches, so that's how many it'll have.", len(t.Players), t.Name, t.Rounds)
+		}
+
+		t.nextRound(ctx)
+
+	case "pairings":
+		if t.Round == 0 {
+			ctx.Post("%s hasn't started yet; the players are %s.", t.Name, orList(t.Players))
+			return
+		}
+		ctx.Post("*%s*, round %d of %d:\n%s", t.Name, t.Round, t.Rounds, t.describeRound())
+
+	default:
+		if t.Round == 0 {
+			ctx.Post("%s (%s) hasn't started yet; the players are %s.", t.Name, t.Format, orList(t.Players))
+			return
+		}
+
+		status := fmt.Sprintf("round %d of %d", t.Round, t.Rounds)
+		if t.Finished {
+			status = "finished"
+		}
+		ctx.Post("*%s* standings, %s:\n%s", t.Name, status, t.table())
+	}
+}
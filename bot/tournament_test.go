@@ -0,0 +1,283 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// pairs writes a round's pairings like "1-4 2-3", players by number, with
+// byes as "1-bye"
+func pairs(t *Tournament, round []*Pairing) string {
+	number := map[string]string{"": "bye"}
+	for i, player := range t.Players {
+		number[player] = fmt.Sprint(i + 1)
+	}
+
+	ret := []string{}
+	for _, p := range round {
+		ret = append(ret, number[p.White]+"-"+number[p.Black])
+	}
+	return strings.Join(ret, " ")
+}
+
+func TestBergerTables(t *testing.T) {
+	for _, test := range []struct {
+		players []string
+		rounds  []string
+	}{
+		{
+			[]string{"a", "b", "c", "d"},
+			[]string{"1-4 2-3", "4-3 1-2", "2-4 3-1"},
+		},
+		// with an odd number, whoever would play the missing sixth player
+		// has a bye
+		{
+			[]string{"a", "b", "c", "d", "e"},
+			[]string{"1-bye 2-5 3-4", "4-bye 5-3 1-2", "2-bye 3-1 4-5", "5-bye 1-4 2-3", "3-bye 4-2 5-1"},
+		},
+	} {
+		tm := &Tournament{Format: roundRobin, Players: test.players}
+		for i, want := range test.rounds {
+			tm.Round = i + 1
+			round := tm.bergerRound()
+			if got := pairs(tm, round); got != want {
+				t.Errorf("%d players, round %d: %s, not %s", len(test.players), tm.Round, got, want)
+			}
+			tm.Pairings = append(tm.Pairings, round...)
+		}
+
+		// everyone meets everyone else exactly once
+		for _, a := range test.players {
+			for _, b := range test.players {
+				n := 0
+				for _, p := range tm.Pairings {
+					if p.White == a && p.Black == b || p.White == b && p.Black == a {
+						n++
+					}
+				}
+				if a != b && n != 1 {
+					t.Errorf("%s and %s met %d times", a, b, n)
+				}
+			}
+		}
+	}
+}
+
+func TestSwissRounds(t *testing.T) {
+	for _, players := range [][]string{
+		{"a", "b", "c", "d", "e", "f"},
+		{"a", "b", "c", "d", "e", "f", "g"},
+		{"a", "b", "c", "d", "e", "f", "g", "h"},
+	} {
+		// results that keep the scores spread out: the higher seed wins,
+		// except that every third game is drawn
+		tm := &Tournament{Format: swiss, Players: players, Rounds: len(players) - 1}
+		games := 0
+		for tm.Round = 1; tm.Round <= tm.Rounds; tm.Round++ {
+			round := tm.swissRound()
+
+			seen := map[string]bool{}
+			for _, p := range round {
+				for _, player := range []string{p.White, p.Black} {
+					if player != "" && seen[player] {
+						t.Fatalf("%d players, round %d: %s is paired twice: %s", len(players), tm.Round, player, pairs(tm, round))
+					}
+					seen[player] = true
+				}
+
+				if p.Black != "" && tm.played(p.White, p.Black) {
+					t.Errorf("%d players, round %d: %s and %s have already played", len(players), tm.Round, p.White, p.Black)
+				}
+				if p.Black == "" && tm.played(p.White, "") {
+					t.Errorf("%d players, round %d: %s has a second bye", len(players), tm.Round, p.White)
+				}
+
+				if p.Black != "" {
+					games++
+					switch {
+					case games%3 == 0:
+						p.Result = "1/2-1/2"
+					case p.White < p.Black:
+						p.Result = "1-0"
+					default:
+						p.Result = "0-1"
+					}
+				}
+			}
+			if len(seen) != len(players)+len(players)%2 {
+				t.Errorf("%d players, round %d: not everyone was paired: %s", len(players), tm.Round, pairs(tm, round))
+			}
+
+			tm.Pairings = append(tm.Pairings, round...)
+		}
+	}
+}
+
+func TestSwissBye(t *testing.T) {
+	tm := &Tournament{Format: swiss, Players: []string{"a", "b", "c"}, Round: 2}
+	tm.Pairings = []*Pairing{
+		{Round: 1, White: "c", Result: "1-0"},
+		{Round: 1, White: "a", Black: "b", Result: "1-0"},
+	}
+
+	// c and a are on a point; b is last, and hasn't had a bye
+	if got := pairs(tm, tm.swissRound()); got != "2-bye 3-1" {
+		t.Errorf("round 2 is %s", got)
+	}
+}
+
+func TestTieBreaks(t *testing.T) {
+	tm := &Tournament{Players: []string{"a", "b", "c", "d", "e"}}
+	tm.Pairings = []*Pairing{
+		{Round: 1, White: "a", Black: "b", Result: "1-0"},
+		{Round: 1, White: "c", Black: "d", Result: "1-0"},
+		{Round: 1, White: "e", Result: "1-0"},
+		{Round: 2, White: "e", Black: "a", Result: "0-1"},
+		{Round: 2, White: "c", Black: "b", Result: "1/2-1/2"},
+		{Round: 2, White: "d", Result: "1-0"},
+	}
+
+	// d and e both have 1, but e's opponent (a, 2) has more than d's (c,
+	// 1.5); their byes don't count. b has the best Buchholz, but the
+	// fewest points.
+	want := `1. *a* 2 (Buchholz 1.5, S-B 1.5)
+2. *c* 1.5 (Buchholz 1.5, S-B 1.25)
+3. *e* 1 (Buchholz 2, S-B 0)
+4. *d* 1 (Buchholz 1.5, S-B 0)
+5. *b* 0.5 (Buchholz 3.5, S-B 0.75)
+`
+	if got := tm.table(); got != want {
+		t.Errorf("standings are\n%s\nnot\n%s", got, want)
+	}
+
+	// a round robin where b and c finish level on points and Buchholz,
+	// and b's draws with a are worth more than c's win over d
+	tm = &Tournament{Players: []string{"a", "b", "c", "d"}}
+	tm.Pairings = []*Pairing{
+		{Round: 1, White: "a", Black: "d", Result: "1-0"},
+		{Round: 1, White: "b", Black: "c", Result: "1/2-1/2"},
+		{Round: 2, White: "d", Black: "c", Result: "0-1"},
+		{Round: 2, White: "a", Black: "b", Result: "1/2-1/2"},
+		{Round: 3, White: "b", Black: "d", Result: "1/2-1/2"},
+		{Round: 3, White: "c", Black: "a", Result: "0-1"},
+	}
+
+	want = `1. *a* 2.5 (Buchholz 3.5, S-B 2.75)
+2. *b* 1.5 (Buchholz 4.5, S-B 2.25)
+3. *c* 1.5 (Buchholz 4.5, S-B 1.25)
+4. *d* 0.5 (Buchholz 5.5, S-B 0.75)
+`
+	if got := tm.table(); got != want {
+		t.Errorf("standings are\n%s\nnot\n%s", got, want)
+	}
+}
+
+func TestOrient(t *testing.T) {
+	tm := &Tournament{}
+	tm.Pairings = []*Pairing{
+		{Round: 1, White: "a", Black: "b"},
+		{Round: 1, White: "c", Black: "d"},
+		{Round: 2, White: "d", Black: "a"},
+		{Round: 2, White: "b", Black: "c"},
+		{Round: 3, White: "c", Black: "f"},
+		{Round: 3, White: "e"},
+	}
+
+	for _, test := range []struct {
+		a, b, white string
+	}{
+		// c has had white once more than b, and f once less than a
+		{"c", "b", "b"},
+		{"a", "f", "f"},
+		// a and d are level, but a had black last
+		{"d", "a", "a"},
+		// both level, and both had white last: the higher ranked gets it
+		{"b", "d", "b"},
+		// byes don't count as white
+		{"e", "a", "e"},
+	} {
+		if white, black := tm.orient(test.a, test.b); white != test.white || (black != test.a && black != test.b) || black == white {
+			t.Errorf("%s vs %s: %s gets white, not %s", test.a, test.b, white, test.white)
+		}
+	}
+}
+
+func TestTournamentCommands(t *testing.T) {
+	games = map[string]*Game{}
+	tournaments = map[string]*Tournament{}
+
+	chat := &fakeChat{}
+	say := func(user, thread, text string) string {
+		chat.posts = nil
+		(&Context{Channel: "chess", Thread: thread, User: user, Text: text, Chat: chat}).Incoming()
+		return strings.Join(chat.posts, "\n")
+	}
+
+	say("alice", "", "chess ok here")
+	say("alice", "", "chess tournament create cup swiss 5 rounds")
+	for _, player := range []string{"alice", "bob", "carol"} {
+		say(player, "", "chess tournament join cup")
+	}
+
+	if said := say("alice", "", "chess tournament start cup"); !strings.Contains(said, "only have 2 rounds") || tournaments["cup"].Rounds != 2 {
+		t.Fatalf("starting a 5 round Swiss for 3 got %q", said)
+	}
+
+	// carol has the bye; alice and bob play in a thread
+	key := tournaments["cup"].Pairings[1].Channel
+	_, thread := splitKey(key)
+	game := games[key]
+	if thread == "" || game == nil || game.Tournament != "cup" || game.White != "alice" || game.Black != "bob" {
+		t.Fatalf("tournament game is %+v", game)
+	}
+
+	say("alice", thread, "reset game")
+	if said := say("alice", thread, "definitely reset"); !strings.Contains(said, "can't be reset") || games[key] != game {
+		t.Errorf("reset a tournament game: %q", said)
+	}
+
+	// once it's over, the board can be reset
+	say("alice", thread, "white wins")
+	say("bob", thread, "white wins")
+	if tournaments["cup"].Pairings[1].Result != "1-0" {
+		t.Errorf("round 1 is %s", pairs(tournaments["cup"], tournaments["cup"].Pairings))
+	}
+	if said := say("alice", thread, "definitely reset"); !strings.Contains(said, "I've reset the game") {
+		t.Errorf("couldn't reset a finished tournament game: %q", said)
+	}
+}
+
+func TestMoveTournamentGame(t *testing.T) {
+	games = map[string]*Game{}
+	tournaments = map[string]*Tournament{}
+
+	chat := &fakeChat{}
+	say := func(user, thread, text string) {
+		(&Context{Channel: "chess", Thread: thread, User: user, Text: text, Chat: chat}).Incoming()
+	}
+
+	say("alice", "", "chess ok here")
+	say("alice", "", "chess tournament create cup round robin")
+	say("alice", "", "chess tournament join cup")
+	say("bob", "", "chess tournament join cup")
+	say("alice", "", "chess tournament start cup")
+
+	p := tournaments["cup"].Pairings[0]
+	_, thread := splitKey(p.Channel)
+	game := games[p.Channel]
+	if thread == "" || game == nil {
+		t.Fatalf("pairing is %+v", p)
+	}
+
+	say("alice", thread, "move game to #chess")
+	if p.Channel != "chess" || games["chess"] != game {
+		t.Errorf("after moving the game, its pairing is in %q", p.Channel)
+	}
+
+	// the result still gets back to the tournament
+	say("bob", "", "white wins")
+	if p.Result != "1-0" || !tournaments["cup"].Finished {
+		t.Errorf("pairing is %+v", p)
+	}
+}
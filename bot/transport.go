@@ -0,0 +1,409 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/nlopes/slack"
+)
+
+// Slack can get events to the bot three ways: the RTM websocket (the
+// original, which new apps can't use), Socket Mode (a websocket the app
+// opens with an app-level token), and the HTTP Events API (Slack calls
+// us). Whichever is configured, events come out as the same *slack event
+// types RTM delivers, so main handles them all in one place.
+
+const (
+	transportRTM    = "rtm"
+	transportSocket = "socket"
+	transportEvents = "events"
+)
+
+// A transport delivers Slack events until it can't carry on, or until stop
+// is closed (when it returns nil)
+type transport interface {
+	run(events chan<- interface{}, stop <-chan struct{}) error
+}
+
+// deliver hands an event on, unless the transport's been stopped while it
+// waited
+func deliver(events chan<- interface{}, stop <-chan struct{}, ev interface{}) bool {
+	select {
+	case events <- ev:
+		return true
+	case <-stop:
+		return false
+	}
+}
+
+// newTransport is the configured transport
+func newTransport(api *slack.Client) transport {
+	switch config.Transport {
+	case transportSocket:
+		return &socketTransport{Token: config.AppToken, API: config.SlackAPI}
+	case transportEvents:
+		return &eventsTransport{
+			Secret: config.SigningSecret,
+			Listen: config.EventsListen,
+			Path:   config.EventsPath,
+		}
+	}
+	return &rtmTransport{API: api}
+}
+
+// rtmTransport is the legacy RTM websocket
+type rtmTransport struct {
+	API *slack.Client
+}
+
+func (t *rtmTransport) run(events chan<- interface{}, stop <-chan struct{}) error {
+	rtm := t.API.NewRTM()
+	go rtm.ManageConnection()
+
+	for {
+		select {
+		case msg, ok := <-rtm.IncomingEvents:
+			if !ok {
+				return errors.New("RTM connection closed")
+			}
+			if !deliver(events, stop, msg.Data) {
+				rtm.Disconnect()
+				return nil
+			}
+
+		case <-stop:
+			rtm.Disconnect()
+			return nil
+		}
+	}
+}
+
+// eventCallback is what the Events API posts, and what Socket Mode's
+// "events_api" messages carry
+type eventCallback struct {
+	Type      string          `json:"type"`
+	Challenge string          `json:"challenge"`
+	Event     json.RawMessage `json:"event"`
+}
+
+// slackEvent decodes a callback's event as the type RTM would have
+// delivered; nil for events the bot doesn't care about
+func slackEvent(raw json.RawMessage) (interface{}, error) {
+	var head struct {
+		Type string `json:"type"`
+	}
+	if err := json.Unmarshal(raw, &head); err != nil {
+		return nil, err
+	}
+
+	var ev interface{}
+	switch head.Type {
+	case "message":
+		ev = &slack.MessageEvent{}
+	case "channel_created":
+		ev = &slack.ChannelCreatedEvent{}
+	default:
+		return nil, nil
+	}
+
+	return ev, json.Unmarshal(raw, ev)
+}
+
+// socketTransport is Socket Mode
+type socketTransport struct {
+	// Token is the app-level token ("xapp-...")
+	Token string
+
+	// API is where Slack's web API lives
+	API string
+}
+
+// fatalSlackErrors are the apps.connections.open errors there's no point
+// retrying
+var fatalSlackErrors = map[string]bool{
+	"invalid_auth":           true,
+	"not_authed":             true,
+	"account_inactive":       true,
+	"token_revoked":          true,
+	"not_allowed_token_type": true,
+}
+
+func (t *socketTransport) run(events chan<- interface{}, stop <-chan struct{}) error {
+	backoff := time.Second
+	for {
+		wsURL, err := t.open()
+		if err != nil && fatalSlackErrors[err.Error()] {
+			return fmt.Errorf("can't open a socket mode connection: %s", err)
+		}
+
+		if err == nil {
+			// Slack asks us to reconnect every so often, which is fine
+			err = t.serve(wsURL, events, stop)
+		}
+
+		select {
+		case <-stop:
+			return nil
+		default:
+		}
+
+		if err == nil {
+			backoff = time.Second
+			continue
+		}
+
+		log.Printf("socket mode: %s; reconnecting in %s", err, backoff)
+		select {
+		case <-time.After(backoff):
+		case <-stop:
+			return nil
+		}
+		if backoff < time.Minute {
+			backoff *= 2
+		}
+	}
+}
+
+// open asks Slack for a websocket URL
+func (t *socketTransport) open() (string, error) {
+	req, err := http.NewRequest("POST", t.API+"apps.connections.open", nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Authorization", "Bearer "+t.Token)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	var res struct {
+		OK    bool   `json:"ok"`
+		URL   string `json:"url"`
+		Error string `json:"error"`
+	}
+	if err = json.NewDecoder(resp.Body).Decode(&res); err != nil {
+		return "", fmt.Errorf("bad apps.connections.open response: %s", err)
+	}
+
+	if !res.OK {
+		return "", errors.New(res.Error)
+	}
+	return res.URL, nil
+}
+
+// serve reads events off a socket until Slack says to reconnect (nil), the
+// connection breaks, or the transport's stopped
+func (t *socketTransport) serve(wsURL string, events chan<- interface{}, stop <-chan struct{}) error {
+	conn, _, err := websocket.DefaultDialer.Dial(wsURL, nil)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	// stopping closes the connection, which gets the read below to give up
+	served := make(chan struct{})
+	defer close(served)
+	go func() {
+		select {
+		case <-stop:
+			conn.Close()
+		case <-served:
+		}
+	}()
+
+	for {
+		var env struct {
+			EnvelopeID string          `json:"envelope_id"`
+			Type       string          `json:"type"`
+			Payload    json.RawMessage `json:"payload"`
+		}
+		if err := conn.ReadJSON(&env); err != nil {
+			return err
+		}
+
+		// everything with an envelope has to be acknowledged, or Slack
+		// sends it again
+		if env.EnvelopeID != "" {
+			if err := conn.WriteJSON(map[string]string{"envelope_id": env.EnvelopeID}); err != nil {
+				return err
+			}
+		}
+
+		switch env.Type {
+		case "disconnect":
+			return nil
+
+		case "events_api":
+			var cb eventCallback
+			if err := json.Unmarshal(env.Payload, &cb); err != nil {
+				log.Printf("socket mode: bad event: %s", err)
+				continue
+			}
+
+			ev, err := slackEvent(cb.Event)
+			if err != nil {
+				log.Printf("socket mode: bad event: %s", err)
+				continue
+			}
+			if ev != nil && !deliver(events, stop, ev) {
+				return nil
+			}
+		}
+	}
+}
+
+// eventsTransport is the HTTP Events API
+type eventsTransport struct {
+	// Secret is the app's signing secret, which every request from Slack
+	// is signed with
+	Secret string
+	Listen string
+	Path   string
+}
+
+// maxSignatureAge is how old a signed request can be before it looks like
+// a replay
+const maxSignatureAge = 5 * time.Minute
+
+// verifySignature checks a request really came from Slack
+func verifySignature(secret string, header http.Header, body []byte, now time.Time) error {
+	ts := header.Get("X-Slack-Request-Timestamp")
+	sec, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil {
+		return errors.New("no request timestamp")
+	}
+
+	if age := now.Sub(time.Unix(sec, 0)); age > maxSignatureAge || age < -maxSignatureAge {
+		return fmt.Errorf("request timestamp is %s off", age)
+	}
+
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "v0:%s:", ts)
+	mac.Write(body)
+	want := "v0=" + hex.EncodeToString(mac.Sum(nil))
+
+	if !hmac.Equal([]byte(want), []byte(header.Get("X-Slack-Signature"))) {
+		return errors.New("bad signature")
+	}
+	return nil
+}
+
+func (t *eventsTransport) run(events chan<- interface{}, stop <-chan struct{}) error {
+	mux := http.NewServeMux()
+	mux.Handle(t.Path, t.handler(events, stop))
+	srv := &http.Server{Addr: t.Listen, Handler: mux}
+
+	served := make(chan struct{})
+	defer close(served)
+	go func() {
+		select {
+		case <-stop:
+			srv.Close()
+		case <-served:
+		}
+	}()
+
+	if err := srv.ListenAndServe(); err != http.ErrServerClosed {
+		return err
+	}
+	return nil
+}
+
+func (t *eventsTransport) handler(events chan<- interface{}, stop <-chan struct{}) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := ioutil.ReadAll(io.LimitReader(r.Body, 1<<20))
+		if err != nil {
+			http.Error(w, "can't read request", http.StatusBadRequest)
+			return
+		}
+
+		if err = verifySignature(t.Secret, r.Header, body, time.Now()); err != nil {
+			log.Printf("rejected events request from %s: %s", r.RemoteAddr, err)
+			http.Error(w, "bad signature", http.StatusUnauthorized)
+			return
+		}
+
+		var cb eventCallback
+		if err = json.Unmarshal(body, &cb); err != nil {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+
+		switch cb.Type {
+		case "url_verification":
+			w.Header().Set("Content-Type", "text/plain")
+			io.WriteString(w, cb.Challenge)
+			return
+
+		case "event_callback":
+			// events are answered as soon as they're queued, so a retry
+			// is for one we already have
+			if r.Header.Get("X-Slack-Retry-Num") != "" {
+				break
+			}
+
+			ev, err := slackEvent(cb.Event)
+			if err != nil {
+				http.Error(w, "bad event", http.StatusBadRequest)
+				return
+			}
+			if ev != nil && !deliver(events, stop, ev) {
+				http.Error(w, "shutting down", http.StatusServiceUnavailable)
+				return
+			}
+		}
+
+		w.WriteHeader(http.StatusOK)
+	})
+}
+
+// validTransport checks the transport settings hang together
+func (c Config) validTransport(problem func(string, ...interface{})) {
+	if u, err := url.Parse(c.SlackAPI); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || !strings.HasSuffix(u.Path, "/") {
+		problem("Slack API URL %q isn't an http or https URL ending in /", c.SlackAPI)
+	}
+
+	switch c.Transport {
+	case transportRTM:
+
+	case transportSocket:
+		if c.AppToken == "" {
+			problem("socket mode needs an app-level token (set CHESSBOT_APP_TOKEN or -app-token)")
+		}
+
+	case transportEvents:
+		if c.SigningSecret == "" {
+			problem("the events API needs a signing secret (set CHESSBOT_SIGNING_SECRET or -signing-secret)")
+		}
+
+		if !strings.HasPrefix(c.EventsPath, "/") {
+			problem("events path %q should start with /", c.EventsPath)
+		}
+
+		if _, _, err := net.SplitHostPort(c.EventsListen); err != nil {
+			problem("can't listen for events on %q: %s", c.EventsListen, err)
+		} else if c.BoardURL != "" && c.EventsListen == c.Listen {
+			problem("events and board images can't both be served on %s", c.Listen)
+		}
+
+	default:
+		problem("unknown transport %q (try rtm, socket or events)", c.Transport)
+	}
+}
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/nlopes/slack"
+)
+
+const testSecret = "8f742231b10e8888abcd99yyyzzz85a5"
+
+// signed is a request to the events API as Slack would sign it at when
+func signed(t *testing.T, url, body string, when time.Time) *http.Request {
+	req, err := http.NewRequest("POST", url, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ts := strconv.FormatInt(when.Unix(), 10)
+	mac := hmac.New(sha256.New, []byte(testSecret))
+	fmt.Fprintf(mac, "v0:%s:%s", ts, body)
+
+	req.Header.Set("X-Slack-Request-Timestamp", ts)
+	req.Header.Set("X-Slack-Signature", "v0="+hex.EncodeToString(mac.Sum(nil)))
+	return req
+}
+
+func TestVerifySignature(t *testing.T) {
+	now := time.Now()
+	body := `{"type":"event_callback"}`
+
+	good := signed(t, "/", body, now)
+	if err := verifySignature(testSecret, good.Header, []byte(body), now); err != nil {
+		t.Errorf("good signature: %s", err)
+	}
+
+	if err := verifySignature(testSecret, good.Header, []byte(body+" "), now); err == nil {
+		t.Error("accepted a changed body")
+	}
+
+	if err := verifySignature("another secret", good.Header, []byte(body), now); err == nil {
+		t.Error("accepted the wrong secret")
+	}
+
+	old := signed(t, "/", body, now.Add(-10*time.Minute))
+	if err := verifySignature(testSecret, old.Header, []byte(body), now); err == nil {
+		t.Error("accepted a replayed request")
+	}
+
+	good.Header.Del("X-Slack-Request-Timestamp")
+	if err := verifySignature(testSecret, good.Header, []byte(body), now); err == nil {
+		t.Error("accepted a request with no timestamp")
+	}
+}
+
+func TestEventsHandler(t *testing.T) {
+	events := make(chan interface{}, 1)
+	srv := httptest.NewServer((&eventsTransport{Secret: testSecret}).handler(events, nil))
+	defer srv.Close()
+
+	do := func(req *http.Request) (int, string) {
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		body, _ := ioutil.ReadAll(resp.Body)
+		return resp.StatusCode, string(body)
+	}
+
+	code, body := do(signed(t, srv.URL, `{"type":"url_verification","challenge":"3eZbrw1aBm2rZgRNFdxV2595E9CY3gmdALWMmHkvFXO7tYXAYM8P"}`, time.Now()))
+	if code != http.StatusOK || body != "3eZbrw1aBm2rZgRNFdxV2595E9CY3gmdALWMmHkvFXO7tYXAYM8P" {
+		t.Errorf("url_verification got %d %q", code, body)
+	}
+
+	unsigned, _ := http.NewRequest("POST", srv.URL, strings.NewReader(`{"type":"url_verification","challenge":"x"}`))
+	if code, _ := do(unsigned); code != http.StatusUnauthorized {
+		t.Errorf("unsigned request got %d", code)
+	}
+
+	message := `{"type":"event_callback","event":{"type":"message","channel":"C1","user":"U1","text":"e2 e4","ts":"1.2"}}`
+	if code, _ := do(signed(t, srv.URL, message, time.Now())); code != http.StatusOK {
+		t.Fatalf("event got %d", code)
+	}
+
+	select {
+	case ev := <-events:
+		if msg, ok := ev.(*slack.MessageEvent); !ok || msg.Channel != "C1" || msg.User != "U1" || msg.Text != "e2 e4" {
+			t.Errorf("got %#v", ev)
+		}
+	default:
+		t.Fatal("event wasn't delivered")
+	}
+
+	retry := signed(t, srv.URL, message, time.Now())
+	retry.Header.Set("X-Slack-Retry-Num", "1")
+	if code, _ := do(retry); code != http.StatusOK || len(events) != 0 {
+		t.Errorf("retry got %d, and %d events", code, len(events))
+	}
+}
+
+func TestSocketMode(t *testing.T) {
+	acks := make(chan string, 4)
+	var opens int32
+
+	mux := http.NewServeMux()
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	mux.HandleFunc("/apps.connections.open", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer xapp-test" {
+			fmt.Fprint(w, `{"ok":false,"error":"invalid_auth"}`)
+			return
+		}
+		n := atomic.AddInt32(&opens, 1)
+		fmt.Fprintf(w, `{"ok":true,"url":"ws%s/socket?n=%d"}`, strings.TrimPrefix(srv.URL, "http"), n)
+	})
+
+	// each connection delivers one message, then asks for a reconnect
+	mux.HandleFunc("/socket", func(w http.ResponseWriter, r *http.Request) {
+		conn, err := (&websocket.Upgrader{}).Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		n := r.URL.Query().Get("n")
+		conn.WriteJSON(map[string]interface{}{"type": "hello"})
+		conn.WriteMessage(websocket.TextMessage, []byte(`{"envelope_id":"env`+n+`","type":"events_api","payload":{"type":"event_callback","event":{"type":"message","channel":"C1","user":"U1","text":"hi `+n+`","ts":"1.2"}}}`))
+
+		var ack struct {
+			EnvelopeID string `json:"envelope_id"`
+		}
+		if err := conn.ReadJSON(&ack); err == nil {
+			acks <- ack.EnvelopeID
+		}
+		conn.WriteJSON(map[string]interface{}{"type": "disconnect", "reason": "refresh_requested"})
+		conn.ReadMessage()
+	})
+
+	if err := (&socketTransport{Token: "xapp-wrong", API: srv.URL + "/"}).run(nil, nil); err == nil || !strings.Contains(err.Error(), "invalid_auth") {
+		t.Errorf("bad token got %v", err)
+	}
+
+	events := make(chan interface{}, 4)
+	stop, stopped := make(chan struct{}), make(chan error, 1)
+	go func() {
+		stopped <- (&socketTransport{Token: "xapp-test", API: srv.URL + "/"}).run(events, stop)
+	}()
+
+	for _, n := range []string{"1", "2"} {
+		select {
+		case ev := <-events:
+			if msg, ok := ev.(*slack.MessageEvent); !ok || msg.Text != "hi "+n {
+				t.Errorf("got %#v", ev)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("no event from connection %s", n)
+		}
+
+		select {
+		case id := <-acks:
+			if id != "env"+n {
+				t.Errorf("acknowledged %q, not env%s", id, n)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("envelope env%s wasn't acknowledged", n)
+		}
+	}
+
+	close(stop)
+	select {
+	case err := <-stopped:
+		if err != nil {
+			t.Errorf("stopping got %s", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Error("the transport didn't stop")
+	}
+}
@@ -53,12 +53,16 @@ func (self Board) Normalize() Board {
 func (board Board) Position(pos string) (int, error) {
 	pos = strings.ToUpper(pos)
 
+	if len(pos) < 2 {
+		return -1, &SquareError{pos, fmt.Sprintf("bad square '%s'", pos)}
+	}
+
 	if pos[0] < 'A' || pos[0] > 'H' {
-		return -1, fmt.Errorf("bad column '%s'", string(pos[0]))
+		return -1, &SquareError{pos, fmt.Sprintf("bad column '%s'", string(pos[0]))}
 	}
 
 	if pos[1] < '1' || pos[1] > '8' {
-		return -1, fmt.Errorf("bad row '%s'", string(pos[1]))
+		return -1, &SquareError{pos, fmt.Sprintf("bad row '%s'", string(pos[1]))}
 	}
 
 	r := int(pos[1] - 48)
@@ -71,12 +75,16 @@ func (board Board) Position(pos string) (int, error) {
 func (board Board) Coord(pos string) (rune, int, error) {
 	pos = strings.ToUpper(pos)
 
+	if len(pos) < 2 {
+		return ' ', 0, &SquareError{pos, fmt.Sprintf("bad square '%s'", pos)}
+	}
+
 	if pos[0] < 'A' || pos[0] > 'H' {
-		return ' ', 0, fmt.Errorf("bad column '%s'", string(pos[0]))
+		return ' ', 0, &SquareError{pos, fmt.Sprintf("bad column '%s'", string(pos[0]))}
 	}
 
 	if pos[1] < '1' || pos[1] > '8' {
-		return ' ', 0, fmt.Errorf("bad row '%s'", string(pos[1]))
+		return ' ', 0, &SquareError{pos, fmt.Sprintf("bad row '%s'", string(pos[1]))}
 	}
 
 	return rune(pos[0]), int(pos[1] - 48), nil
@@ -181,15 +189,16 @@ func (board Board) validMoves(pos int) (valid []coord) {
 				yep(or-1, oc+1)
 			}
 
-			if or == 7 && empty(or-2, oc) {
+			if or == 7 && empty(or-1, oc) && empty(or-2, oc) {
 				yep(or-2, oc)
 			}
 
-			if or == 4 && oc != 0 && board[indexFromCoords(or, oc-1)] == 'p' {
+			// en passant, which Position checks against the e.p. square
+			if or == 4 && oc != 0 && board[indexFromCoords(or, oc-1)] == 'p' && empty(or-1, oc-1) {
 				yep(or-1, oc-1)
 			}
 
-			if or == 4 && oc != 7 && board[indexFromCoords(or, oc+1)] == 'p' {
+			if or == 4 && oc != 7 && board[indexFromCoords(or, oc+1)] == 'p' && empty(or-1, oc+1) {
 				yep(or-1, oc+1)
 			}
 		}
@@ -208,15 +217,15 @@ func (board Board) validMoves(pos int) (valid []coord) {
 				yep(or+1, oc+1)
 			}
 
-			if or == 2 && empty(or+2, oc) {
+			if or == 2 && empty(or+1, oc) && empty(or+2, oc) {
 				yep(or+2, oc)
 			}
 
-			if or == 5 && oc != 0 && board[indexFromCoords(or, oc-1)] == 'P' {
+			if or == 5 && oc != 0 && board[indexFromCoords(or, oc-1)] == 'P' && empty(or+1, oc-1) {
 				yep(or+1, oc-1)
 			}
 
-			if or == 5 && oc != 7 && board[indexFromCoords(or, oc+1)] == 'P' {
+			if or == 5 && oc != 7 && board[indexFromCoords(or, oc+1)] == 'P' && empty(or+1, oc+1) {
 				yep(or+1, oc+1)
 			}
 		}
@@ -360,7 +369,7 @@ func (board Board) CoordsToAlgebraic(srcs, dsts string) (string, error) {
 	}
 
 	if board[src] == '_' {
-		return "", fmt.Errorf("no piece at %s", srcs)
+		return "", illegal(srcs+"-"+dsts, ILLEGAL_NO_PIECE, "no piece at %s", srcs)
 	}
 
 	x := ""
@@ -396,7 +405,7 @@ func (board Board) CoordsToAlgebraic(srcs, dsts string) (string, error) {
 		return try, nil
 	}
 
-	return "", fmt.Errorf("can't find a valid move described by %s->%s", srcs, dsts)
+	return "", illegal(srcs+"-"+dsts, ILLEGAL_CANT_MOVE_THERE, "can't find a valid move described by %s->%s", srcs, dsts)
 }
 
 func (board Board) Algebraic(move string, isWhite bool) (string, string, error) {
@@ -418,7 +427,7 @@ func (board Board) Algebraic(move string, isWhite bool) (string, string, error)
 
 	matches := AlgebraicRx.FindStringSubmatch(move)
 	if matches == nil {
-		return "", "", fmt.Errorf("invalid notation: %s", move)
+		return "", "", &NotationError{move}
 	}
 
 	piece := matches[1][0]
@@ -454,30 +463,67 @@ func (board Board) Algebraic(move string, isWhite bool) (string, string, error)
 		cands = append(cands, p)
 	}
 
-	src := ""
 	drow, dcol := coordsFromIndex(dst)
 
-	// fmt.Printf("candidates: %#v\n", cands)
-
+	srcs := []int{}
 	for _, p := range cands {
 		for _, mv := range board.validMoves(p) {
 			if mv.row == drow && mv.col == dcol {
-				if src != "" {
-					return "", "", fmt.Errorf("ambiguous move")
-				}
-
-				srow, scol := coordsFromIndex(p)
-
-				src = fmt.Sprintf("%c%d", 'A'+scol, srow)
+				srcs = append(srcs, p)
 			}
 		}
 	}
 
-	if src == "" {
-		return "", "", fmt.Errorf("no matching move")
+	if len(srcs) > 1 {
+		return "", "", &AmbiguousMoveError{move, board.disambiguate(srcs, dst)}
 	}
 
-	return src, matches[5], nil
+	if len(srcs) == 0 {
+		return "", "", illegal(move, ILLEGAL_NO_MATCH, "no matching move")
+	}
+
+	srow, scol := coordsFromIndex(srcs[0])
+	return fmt.Sprintf("%c%d", 'A'+scol, srow), matches[5], nil
+}
+
+// disambiguate writes out a move by each of several pieces to the same
+// square, like "Nbd2", with just enough of the starting square to tell them
+// apart
+func (board Board) disambiguate(srcs []int, dst int) (ret []string) {
+	dr, dc := coordsFromIndex(dst)
+	to := fmt.Sprintf("%c%d", 'a'+dc, dr)
+
+	x := ""
+	if board[dst] != '_' {
+		x = "x"
+	}
+
+	for _, p := range srcs {
+		r, c := coordsFromIndex(p)
+		sameFile, sameRank := false, false
+		for _, o := range srcs {
+			or, oc := coordsFromIndex(o)
+			if o != p {
+				sameFile = sameFile || oc == c
+				sameRank = sameRank || or == r
+			}
+		}
+
+		from := fmt.Sprintf("%c", 'a'+c)
+		if sameFile && !sameRank {
+			from = fmt.Sprintf("%d", r)
+		} else if sameFile {
+			from = fmt.Sprintf("%c%d", 'a'+c, r)
+		}
+
+		piece := board[p]
+		if piece >= 'a' {
+			piece -= 32
+		}
+
+		ret = append(ret, fmt.Sprintf("%c%s%s%s", piece, from, x, to))
+	}
+	return
 }
 
 // Move moves pieces on a board, returning the new board, or an error if
@@ -501,7 +547,7 @@ func (board Board) Move(starts, stops string) (Board, error) {
 	piece := board[start]
 
 	if piece == '_' {
-		return board, fmt.Errorf("no piece at %s", starts)
+		return board, illegal(starts+"-"+stops, ILLEGAL_NO_PIECE, "no piece at %s", starts)
 	}
 
 	if piece == 'k' && starts == "E1" && (stops == "G1" || stops == "C1") {
@@ -0,0 +1,340 @@
+package chess
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Time controls and chess clocks. A TimeControl is parsed from the usual
+// shorthand:
+//
+//   "5+3"           5 minutes each, plus 3 seconds a move
+//   "40/90+30"      90 minutes for 40 moves, plus 30 seconds a move
+//   "40/90,30+30"   then 30 more minutes for the rest of the game
+//   "5+3 delay"     3 seconds of simple delay instead of an increment
+//   "5+3 bronstein" Bronstein delay
+//   "1d per move"   correspondence: a day for every move
+//
+// Bare numbers are minutes for the main time and seconds for the bonus;
+// either can have a unit (s, m, h or d) instead.
+
+// Kinds of per-move bonus
+const (
+	BONUS_FISCHER = iota
+	BONUS_BRONSTEIN
+	BONUS_DELAY
+)
+
+// A Period is a stretch of the game with its own time allowance; Moves is
+// 0 for the rest of the game
+type Period struct {
+	Moves int
+	Time  time.Duration
+}
+
+// A TimeControl says how much time each side gets
+type TimeControl struct {
+	Periods []Period
+
+	// Bonus is the increment or delay, and BonusKind one of the BONUS_
+	// constants
+	Bonus     time.Duration
+	BonusKind int
+
+	// PerMove means each move gets the first period's time afresh, as in
+	// correspondence games
+	PerMove bool
+}
+
+var (
+	perMoveRx = regexp.MustCompile(`^(\d+\s*[a-z]*)\s*(per|/|a)\s*move$`)
+	periodRx  = regexp.MustCompile(`^(?:(\d+)/)?(\d+\s*[a-z]*)$`)
+	bonusRx   = regexp.MustCompile(`\s+(delay|bronstein|fischer|increment)$`)
+)
+
+// parseDuration reads "90", "30s", "1h", "2 days" and so on; bare numbers
+// are in units of def
+func parseDuration(s string, def time.Duration) (time.Duration, error) {
+	s = strings.TrimSpace(s)
+	i := 0
+	for i < len(s) && s[i] >= '0' && s[i] <= '9' {
+		i++
+	}
+
+	n, err := strconv.Atoi(s[:i])
+	if err != nil {
+		return 0, fmt.Errorf("bad time '%s'", s)
+	}
+
+	unit := def
+	switch strings.TrimSpace(s[i:]) {
+	case "":
+	case "s", "sec", "secs", "second", "seconds":
+		unit = time.Second
+	case "m", "min", "mins", "minute", "minutes":
+		unit = time.Minute
+	case "h", "hr", "hrs", "hour", "hours":
+		unit = time.Hour
+	case "d", "day", "days":
+		unit = 24 * time.Hour
+	default:
+		return 0, fmt.Errorf("bad time '%s'", s)
+	}
+
+	return time.Duration(n) * unit, nil
+}
+
+// ParseTimeControl reads a time control in the shorthand above
+func ParseTimeControl(s string) (TimeControl, error) {
+	tc := TimeControl{}
+	s = strings.ToLower(strings.TrimSpace(s))
+	orig := s
+
+	if tox := perMoveRx.FindStringSubmatch(s); tox != nil {
+		d, err := parseDuration(tox[1], time.Minute)
+		if err != nil || d <= 0 {
+			return tc, fmt.Errorf("bad time control '%s'", orig)
+		}
+		tc.Periods = []Period{{Time: d}}
+		tc.PerMove = true
+		return tc, nil
+	}
+
+	if tox := bonusRx.FindStringSubmatch(s); tox != nil {
+		switch tox[1] {
+		case "delay":
+			tc.BonusKind = BONUS_DELAY
+		case "bronstein":
+			tc.BonusKind = BONUS_BRONSTEIN
+		}
+		s = s[:len(s)-len(tox[0])]
+	}
+
+	if plus := strings.LastIndex(s, "+"); plus != -1 {
+		d, err := parseDuration(s[plus+1:], time.Second)
+		if err != nil {
+			return tc, fmt.Errorf("bad time control '%s': %s", orig, err)
+		}
+		tc.Bonus = d
+		s = s[:plus]
+	}
+
+	for _, part := range strings.Split(s, ",") {
+		tox := periodRx.FindStringSubmatch(strings.TrimSpace(part))
+		if tox == nil {
+			return tc, fmt.Errorf("bad time control '%s'", orig)
+		}
+
+		period := Period{}
+		if tox[1] != "" {
+			period.Moves, _ = strconv.Atoi(tox[1])
+			if period.Moves == 0 {
+				return tc, fmt.Errorf("bad time control '%s': a period needs moves", orig)
+			}
+		}
+
+		d, err := parseDuration(tox[2], time.Minute)
+		if err != nil {
+			return tc, fmt.Errorf("bad time control '%s': %s", orig, err)
+		}
+		period.Time = d
+
+		tc.Periods = append(tc.Periods, period)
+	}
+
+	if tc.Periods[0].Time <= 0 {
+		return tc, fmt.Errorf("bad time control '%s': no time", orig)
+	}
+
+	return tc, nil
+}
+
+// formatDuration writes a duration the way parseDuration reads it, bare if
+// it's a whole number of def and with a unit otherwise (def 0 for always)
+func formatDuration(d, def time.Duration) string {
+	switch {
+	case def != 0 && d%def == 0:
+		return strconv.Itoa(int(d / def))
+	case d%(24*time.Hour) == 0:
+		return fmt.Sprintf("%dd", d/(24*time.Hour))
+	case d%time.Hour == 0:
+		return fmt.Sprintf("%dh", d/time.Hour)
+	case d%time.Minute == 0:
+		return fmt.Sprintf("%dm", d/time.Minute)
+	}
+	return fmt.Sprintf("%ds", d/time.Second)
+}
+
+// String writes the time control back out in the same shorthand
+func (tc TimeControl) String() string {
+	if len(tc.Periods) == 0 {
+		return "untimed"
+	}
+
+	if tc.PerMove {
+		return fmt.Sprintf("%s per move", formatDuration(tc.Periods[0].Time, 0))
+	}
+
+	parts := []string{}
+	for _, period := range tc.Periods {
+		part := formatDuration(period.Time, time.Minute)
+		if period.Moves != 0 {
+			part = fmt.Sprintf("%d/%s", period.Moves, part)
+		}
+		parts = append(parts, part)
+	}
+
+	ret := strings.Join(parts, ",")
+	if tc.Bonus != 0 {
+		ret += "+" + formatDuration(tc.Bonus, time.Second)
+		switch tc.BonusKind {
+		case BONUS_DELAY:
+			ret += " delay"
+		case BONUS_BRONSTEIN:
+			ret += " bronstein"
+		}
+	}
+	return ret
+}
+
+// A Clock keeps time for both sides of a game under a TimeControl. It's
+// driven by the caller passing in the current time, so it never reads the
+// wall clock itself.
+type Clock struct {
+	Control TimeControl
+
+	// Left is the time each side had when its clock last stopped, indexed
+	// white then black
+	Left [2]time.Duration
+
+	// Moves is how many moves each side has finished
+	Moves [2]int
+
+	// WhiteToMove is whose clock runs, from Since; a zero Since means the
+	// clock is stopped
+	WhiteToMove bool
+	Since       time.Time
+}
+
+// NewClock sets up a stopped clock with white to move
+func NewClock(tc TimeControl) *Clock {
+	clock := &Clock{
+		Control:     tc,
+		WhiteToMove: true,
+	}
+
+	if len(tc.Periods) != 0 {
+		clock.Left[0] = tc.Periods[0].Time
+		clock.Left[1] = tc.Periods[0].Time
+	}
+
+	return clock
+}
+
+// Start sets the side to move's clock running
+func (clock *Clock) Start(now time.Time) {
+	if clock.Since.IsZero() {
+		clock.Since = now
+	}
+}
+
+// Stop pauses the clock, charging the side to move for the time used
+func (clock *Clock) Stop(now time.Time) {
+	if clock.Since.IsZero() {
+		return
+	}
+
+	clock.Left[side(clock.WhiteToMove)] = clock.Remaining(clock.WhiteToMove, now)
+	clock.Since = time.Time{}
+}
+
+// used is how much of the side to move's time a think of elapsed costs,
+// taking simple delay into account
+func (clock *Clock) used(elapsed time.Duration) time.Duration {
+	if clock.Control.BonusKind != BONUS_DELAY {
+		return elapsed
+	}
+	if elapsed < clock.Control.Bonus {
+		return 0
+	}
+	return elapsed - clock.Control.Bonus
+}
+
+// Remaining returns how much time a side has left at now; it can be
+// negative once the flag has fallen
+func (clock *Clock) Remaining(white bool, now time.Time) time.Duration {
+	left := clock.Left[side(white)]
+	if white == clock.WhiteToMove && !clock.Since.IsZero() {
+		left -= clock.used(now.Sub(clock.Since))
+	}
+	return left
+}
+
+// Give adds time to a side's clock
+func (clock *Clock) Give(white bool, d time.Duration) {
+	clock.Left[side(white)] += d
+}
+
+// Flagged reports whether a side has run out of time
+func (clock *Clock) Flagged(white bool, now time.Time) bool {
+	return len(clock.Control.Periods) != 0 && clock.Remaining(white, now) <= 0
+}
+
+// period returns which period a side is in after moves moves
+func (clock *Clock) period(moves int) int {
+	i := 0
+	for ; i < len(clock.Control.Periods)-1; i++ {
+		if clock.Control.Periods[i].Moves == 0 || moves < clock.Control.Periods[i].Moves {
+			break
+		}
+		moves -= clock.Control.Periods[i].Moves
+	}
+	return i
+}
+
+// Press ends the side to move's turn at now: its time is charged, the
+// bonus and any new period's time added, and the other clock started. It
+// returns an error, leaving the clock stopped, if the flag fell first.
+func (clock *Clock) Press(now time.Time) error {
+	white := clock.WhiteToMove
+	s := side(white)
+
+	var elapsed time.Duration
+	if !clock.Since.IsZero() {
+		elapsed = now.Sub(clock.Since)
+	}
+
+	clock.Stop(now)
+	if clock.Flagged(white, now) {
+		return fmt.Errorf("%s ran out of time", colorName(white))
+	}
+
+	tc := clock.Control
+	clock.Moves[s]++
+
+	switch {
+	case tc.PerMove:
+		clock.Left[s] = tc.Periods[0].Time
+	case tc.BonusKind == BONUS_FISCHER:
+		clock.Left[s] += tc.Bonus
+	case tc.BonusKind == BONUS_BRONSTEIN:
+		if elapsed < tc.Bonus {
+			clock.Left[s] += elapsed
+		} else {
+			clock.Left[s] += tc.Bonus
+		}
+	}
+
+	if !tc.PerMove {
+		if p := clock.period(clock.Moves[s]); p != clock.period(clock.Moves[s]-1) {
+			clock.Left[s] += tc.Periods[p].Time
+		}
+	}
+
+	clock.WhiteToMove = !white
+	clock.Since = now
+	return nil
+}
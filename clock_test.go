@@ -0,0 +1,133 @@
+package chess
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseTimeControl(t *testing.T) {
+	for _, test := range []struct {
+		in, out string
+		want    TimeControl
+	}{
+		{"5+3", "5+3", TimeControl{Periods: []Period{{Time: 5 * time.Minute}}, Bonus: 3 * time.Second}},
+		{"90s", "90s", TimeControl{Periods: []Period{{Time: 90 * time.Second}}}},
+		{"40/90+30", "40/90+30", TimeControl{Periods: []Period{{40, 90 * time.Minute}}, Bonus: 30 * time.Second}},
+		{"40/2h, 30 + 30", "40/120,30+30", TimeControl{Periods: []Period{{40, 2 * time.Hour}, {0, 30 * time.Minute}}, Bonus: 30 * time.Second}},
+		{"5+3 Delay", "5+3 delay", TimeControl{Periods: []Period{{Time: 5 * time.Minute}}, Bonus: 3 * time.Second, BonusKind: BONUS_DELAY}},
+		{"5+3 bronstein", "5+3 bronstein", TimeControl{Periods: []Period{{Time: 5 * time.Minute}}, Bonus: 3 * time.Second, BonusKind: BONUS_BRONSTEIN}},
+		{"5+1m increment", "5+60", TimeControl{Periods: []Period{{Time: 5 * time.Minute}}, Bonus: time.Minute}},
+		{"1d per move", "1d per move", TimeControl{Periods: []Period{{Time: 24 * time.Hour}}, PerMove: true}},
+		{"3 days/move", "3d per move", TimeControl{Periods: []Period{{Time: 72 * time.Hour}}, PerMove: true}},
+	} {
+		tc, err := ParseTimeControl(test.in)
+		if err != nil {
+			t.Errorf("%s: %s", test.in, err)
+			continue
+		}
+		if !reflect.DeepEqual(tc, test.want) {
+			t.Errorf("%s is %+v, not %+v", test.in, tc, test.want)
+		}
+		if tc.String() != test.out {
+			t.Errorf("%s came back as %q, not %q", test.in, tc.String(), test.out)
+		}
+	}
+
+	for _, in := range []string{"", "0", "0+5", "5+", "+3", "5 fortnights", "0/90", "40/90,", "5+3 sudden", "0 per move"} {
+		if tc, err := ParseTimeControl(in); err == nil {
+			t.Errorf("%q parsed as %+v", in, tc)
+		}
+	}
+
+	if (TimeControl{}).String() != "untimed" {
+		t.Error("no periods isn't untimed")
+	}
+}
+
+// pressAfter runs the side to move's clock for d and presses it
+func pressAfter(t *testing.T, clock *Clock, now *time.Time, d time.Duration) {
+	*now = now.Add(d)
+	if err := clock.Press(*now); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestClockPress(t *testing.T) {
+	start := time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	for _, test := range []struct {
+		control string
+		// each side thinks for these in turn, white first
+		thinks []time.Duration
+		white  time.Duration
+		black  time.Duration
+	}{
+		{"5+3", []time.Duration{10 * time.Second, 20 * time.Second}, 293 * time.Second, 283 * time.Second},
+		// delay is free thinking, and nothing is added
+		{"5+3 delay", []time.Duration{2 * time.Second, 10 * time.Second}, 5 * time.Minute, 293 * time.Second},
+		// bronstein gives back what was used, up to the bonus
+		{"5+3 bronstein", []time.Duration{2 * time.Second, 10 * time.Second}, 5 * time.Minute, 293 * time.Second},
+		// the second period's time arrives after move 2
+		{"2/1,1", []time.Duration{10 * time.Second, 0, 10 * time.Second, 0}, 100 * time.Second, 2 * time.Minute},
+		{"1h per move", []time.Duration{50 * time.Minute, 10 * time.Minute}, time.Hour, time.Hour},
+	} {
+		tc, err := ParseTimeControl(test.control)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		clock := NewClock(tc)
+		now := start
+		clock.Start(now)
+		for _, d := range test.thinks {
+			pressAfter(t, clock, &now, d)
+		}
+
+		if w, b := clock.Remaining(true, now), clock.Remaining(false, now); w != test.white || b != test.black {
+			t.Errorf("%s: white has %s and black %s, not %s and %s", test.control, w, b, test.white, test.black)
+		}
+		if clock.WhiteToMove != (len(test.thinks)%2 == 0) {
+			t.Errorf("%s: wrong side to move", test.control)
+		}
+	}
+}
+
+func TestClockFlag(t *testing.T) {
+	tc, _ := ParseTimeControl("1+0")
+	clock := NewClock(tc)
+
+	now := time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC)
+	clock.Start(now)
+
+	if clock.Flagged(true, now.Add(59*time.Second)) || !clock.Flagged(true, now.Add(time.Minute)) {
+		t.Error("white's flag should fall at a minute")
+	}
+	if clock.Flagged(false, now.Add(time.Hour)) {
+		t.Error("black's clock isn't running")
+	}
+
+	if err := clock.Press(now.Add(61 * time.Second)); err == nil {
+		t.Fatal("pressed after the flag fell")
+	}
+	if !clock.Since.IsZero() || !clock.WhiteToMove || clock.Moves[0] != 0 {
+		t.Errorf("a late press changed the clock: %+v", clock)
+	}
+
+	// stopping keeps the time, and a stopped clock doesn't run
+	clock = NewClock(tc)
+	clock.Start(now)
+	clock.Stop(now.Add(20 * time.Second))
+	if left := clock.Remaining(true, now.Add(time.Hour)); left != 40*time.Second {
+		t.Errorf("stopped with %s left", left)
+	}
+
+	clock.Give(false, 15*time.Second)
+	if left := clock.Remaining(false, now); left != 75*time.Second {
+		t.Errorf("black has %s after being given 15s", left)
+	}
+
+	if NewClock(TimeControl{}).Flagged(true, now.Add(time.Hour)) {
+		t.Error("an untimed game flagged")
+	}
+}
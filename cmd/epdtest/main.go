@@ -0,0 +1,79 @@
+// epdtest runs an EPD test suite (like WAC) through the chess package's
+// search and counts how many positions it solves.
+//
+//	epdtest -time 5s wac.epd
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/tqbf/chess"
+)
+
+func main() {
+	limit := flag.Duration("time", 5*time.Second, "time to search each position")
+	verbose := flag.Bool("v", false, "print every position, not just failures")
+	flag.Parse()
+
+	if flag.NArg() != 1 {
+		fmt.Fprintf(os.Stderr, "usage: epdtest [-time 5s] [-v] suite.epd\n")
+		os.Exit(2)
+	}
+
+	f, err := os.Open(flag.Arg(0))
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer f.Close()
+
+	solved, failed := 0, 0
+	start := time.Now()
+
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		epd, err := chess.ParseEPD(line)
+		if err != nil {
+			log.Printf("line %d: %s", n, err)
+			continue
+		}
+
+		id := epd.ID()
+		if id == "" {
+			id = fmt.Sprintf("line %d", n)
+		}
+
+		move, score := epd.Position.Search(*limit)
+		san, _ := epd.Position.SAN(move)
+
+		if epd.Solved(move) {
+			solved++
+			if *verbose {
+				fmt.Printf("%s: solved with %s (%d)\n", id, san, score)
+			}
+		} else {
+			failed++
+			want := "bm " + strings.Join(epd.BestMoves(), " ")
+			if len(epd.BestMoves()) == 0 {
+				want = "am " + strings.Join(epd.AvoidMoves(), " ")
+			}
+			fmt.Printf("%s: FAILED, played %s (%d), wanted %s\n", id, san, score, want)
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		log.Fatal(err)
+	}
+
+	fmt.Printf("solved %d, failed %d, of %d in %s\n", solved, failed, solved+failed, time.Since(start).Round(time.Second))
+}
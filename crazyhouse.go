@@ -0,0 +1,132 @@
+package chess
+
+import (
+	"regexp"
+	"strings"
+)
+
+// In crazyhouse, captured pieces go into the capturer's pocket, and instead
+// of moving you can drop a piece from your pocket onto any empty square.
+// Drops are written "N@f3".
+
+var DropRx = regexp.MustCompile("([PBNRQ])@([a-h][1-8])")
+
+// pocketOrder is the order pockets are kept in, most valuable first
+const pocketOrder = "qrbnpQRBNP"
+
+func sortPocket(pocket string) string {
+	out := []byte{}
+	for i := 0; i < len(pocketOrder); i++ {
+		for n := strings.Count(pocket, pocketOrder[i:i+1]); n > 0; n-- {
+			out = append(out, pocketOrder[i])
+		}
+	}
+	return string(out)
+}
+
+// pocket puts a captured piece in the side to move's pocket, changing it to
+// the capturer's color; promoted pieces go back to being pawns
+func (p Position) pocket(captured byte, promoted bool) Position {
+	if promoted {
+		captured = 'p'
+	}
+
+	if p.WhiteToMove {
+		p.WhitePocket = sortPocket(p.WhitePocket + strings.ToLower(string(captured)))
+	} else {
+		p.BlackPocket = sortPocket(p.BlackPocket + strings.ToUpper(string(captured)))
+	}
+
+	return p
+}
+
+// Pocket returns the pieces the side to move can drop
+func (p Position) Pocket() string {
+	if p.WhiteToMove {
+		return p.WhitePocket
+	}
+	return p.BlackPocket
+}
+
+// Drop drops a piece from the side to move's pocket, given a move like "N@f3",
+// returning the new position or an error if the drop isn't allowed.
+func (p Position) Drop(move string) (Position, error) {
+	if p.Variant != VARIANT_CRAZYHOUSE {
+		return p, illegal(move, ILLEGAL_DROP, "you can only drop pieces in crazyhouse")
+	}
+
+	matches := DropRx.FindStringSubmatch(move)
+	if matches == nil {
+		return p, &NotationError{move}
+	}
+
+	piece := matches[1]
+	if p.WhiteToMove {
+		piece = strings.ToLower(piece)
+	}
+
+	dst, err := p.Board.Position(matches[2])
+	if err != nil {
+		return p, err
+	}
+
+	pocket := p.Pocket()
+	if !strings.Contains(pocket, piece) {
+		return p, illegal(move, ILLEGAL_DROP, "no %s in %s's pocket", matches[1], colorName(p.WhiteToMove))
+	}
+
+	if p.Board[dst] != '_' {
+		return p, illegal(move, ILLEGAL_DROP, "%s isn't empty", strings.ToUpper(matches[2]))
+	}
+
+	if (piece == "p" || piece == "P") && (dst < 8 || dst >= 56) {
+		return p, illegal(move, ILLEGAL_DROP, "can't drop a pawn on the first or last rank")
+	}
+
+	pocket = strings.Replace(pocket, piece, "", 1)
+
+	next := p
+	next.Board = p.Board.Replace(rune(piece[0]), dst)
+
+	if next.Board.InCheck(p.WhiteToMove) {
+		return p, illegal(move, ILLEGAL_LEAVES_CHECK, "that leaves %s's king in check", colorName(p.WhiteToMove))
+	}
+
+	next.EnPassant = ""
+	next.HalfMoves++
+	next.Promoted &^= 1 << uint(dst)
+
+	if p.WhiteToMove {
+		next.WhitePocket = pocket
+	} else {
+		next.BlackPocket = pocket
+		next.FullMoves++
+	}
+	next.WhiteToMove = !p.WhiteToMove
+
+	return next, nil
+}
+
+// Drops returns every drop the side to move can make, like "N@f3"
+func (p Position) Drops() (ret []string) {
+	if p.Variant != VARIANT_CRAZYHOUSE {
+		return nil
+	}
+
+	pocket := p.Pocket()
+
+	for i := 0; i < len(pocketOrder); i++ {
+		if !strings.Contains(pocket, pocketOrder[i:i+1]) {
+			continue
+		}
+
+		for dst := 0; dst < 64; dst++ {
+			move := strings.ToUpper(pocketOrder[i:i+1]) + "@" + strings.ToLower(indexName(dst))
+			if _, err := p.Drop(move); err == nil {
+				ret = append(ret, move)
+			}
+		}
+	}
+
+	return
+}
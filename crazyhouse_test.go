@@ -0,0 +1,138 @@
+package chess
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCrazyhouseFEN(t *testing.T) {
+	for _, test := range []struct {
+		fen, want string
+	}{
+		// pockets are kept most valuable piece first
+		{"rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR[] w KQkq - 0 1", ""},
+		{"r1bqkbnr/pppp1ppp/2n5/4p3/4P3/5N2/PPPP1PPP/RNBQKB1R[PnQ] b KQkq - 2 3", "r1bqkbnr/pppp1ppp/2n5/4p3/4P3/5N2/PPPP1PPP/RNBQKB1R[QPn] b KQkq - 2 3"},
+		// a ninth rank is the same as brackets
+		{"rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR/Nb w KQkq - 0 1", "rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR[Nb] w KQkq - 0 1"},
+		// promoted pieces keep their marker
+		{"4k3/8/8/8/8/8/8/Q~3K3[p] b - - 0 40", ""},
+	} {
+		p, err := ParseFEN(test.fen)
+		if err != nil {
+			t.Errorf("%s: %s", test.fen, err)
+			continue
+		}
+
+		if p.Variant != VARIANT_CRAZYHOUSE {
+			t.Errorf("%s isn't crazyhouse", test.fen)
+		}
+
+		want := test.want
+		if want == "" {
+			want = test.fen
+		}
+		if got := p.FEN(); got != want {
+			t.Errorf("%s came back as %s, not %s", test.fen, got, want)
+		}
+	}
+
+	for _, fen := range []string{
+		"rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR[Kx w KQkq - 0 1",
+		"rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR[K] w KQkq - 0 1",
+		"~nbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR[] w KQkq - 0 1",
+	} {
+		if _, err := ParseFEN(fen); err == nil {
+			t.Errorf("%s shouldn't parse", fen)
+		}
+	}
+}
+
+func TestPocket(t *testing.T) {
+	p, err := ParseFEN("4k3/8/8/3n4/4P3/8/8/4K3[] w - - 0 1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if p, err = p.Play("E4-D5"); err != nil {
+		t.Fatal(err)
+	}
+	if p.WhitePocket != "n" || p.BlackPocket != "" {
+		t.Errorf("after exd5 the pockets are %q and %q", p.WhitePocket, p.BlackPocket)
+	}
+	if got := p.FEN(); got != "4k3/8/8/3P4/8/8/8/4K3[N] b - - 0 1" {
+		t.Errorf("after exd5: %s", got)
+	}
+
+	// a promoted piece goes back in the pocket as a pawn
+	p, err = ParseFEN("q~3k3/8/8/8/8/8/8/R3K3[] w - - 0 1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p, err = p.Play("A1-A8"); err != nil {
+		t.Fatal(err)
+	}
+	if p.WhitePocket != "p" || p.Promoted != 0 {
+		t.Errorf("taking a promoted queen: %s", p.FEN())
+	}
+}
+
+func TestDrops(t *testing.T) {
+	p, err := ParseFEN("4k3/8/8/8/8/8/8/4K3[Pn] w - - 0 1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	drops := p.Drops()
+	if len(drops) != 48 {
+		t.Errorf("%d pawn drops, not 48: %v", len(drops), drops)
+	}
+	for _, drop := range drops {
+		if !strings.HasPrefix(drop, "P@") {
+			t.Errorf("white can't drop %s", drop)
+		}
+	}
+
+	// drops are in the move list, and play like moves
+	found := false
+	for _, move := range p.Moves() {
+		found = found || move == "P@e4"
+	}
+	if !found {
+		t.Error("P@e4 isn't in the move list")
+	}
+
+	next, err := p.Play("P@e4")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if next.Board[indexFromCoords(4, 4)] != 'p' || next.WhitePocket != "" || next.WhiteToMove {
+		t.Errorf("after P@e4: %s", next.FEN())
+	}
+
+	for _, drop := range []string{
+		"P@e8", // last rank
+		"P@e1", // occupied
+		"N@f3", // not white's knight
+		"Q@d4", // nothing to drop
+	} {
+		if _, err := p.Drop(drop); err == nil {
+			t.Errorf("%s shouldn't be allowed", drop)
+		}
+	}
+
+	// a drop has to answer check
+	p, err = ParseFEN("4k3/8/8/8/8/8/8/r3K3[N] w - - 0 1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.Drop("N@h3"); err == nil {
+		t.Error("N@h3 leaves the king in check")
+	}
+	if drops := p.Drops(); len(drops) != 3 {
+		t.Errorf("only N@b1, N@c1 and N@d1 block, not %v", drops)
+	}
+
+	if _, err := StartingPosition(VARIANT_STANDARD).Drop("P@e4"); err == nil {
+		t.Error("dropped a piece outside crazyhouse")
+	}
+}
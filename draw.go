@@ -1,8 +1,10 @@
 package chess
 
 import (
+	"fmt"
 	"image"
 	"image/color"
+	"math"
 	"strings"
 
 	"github.com/llgcode/draw2d"
@@ -49,6 +51,7 @@ var (
 const (
 	HI_CAPTURED = iota
 	HI_MOVED
+	HI_CHECK
 )
 
 type Highlight struct {
@@ -57,15 +60,142 @@ type Highlight struct {
 	Col  rune
 }
 
-// Draw draws a chessboard into a width x width square RGBA image
+// checkHighlights returns highlights for any king that's in check
+func (board Board) checkHighlights() (ret []Highlight) {
+	for _, white := range []bool{true, false} {
+		if k := board.king(white); k != -1 && board.InCheck(white) {
+			r, c := coordsFromIndex(k)
+			ret = append(ret, Highlight{
+				Kind: HI_CHECK,
+				Row:  r,
+				Col:  rune('A' + c),
+			})
+		}
+	}
+	return
+}
+
+// Draw draws a chessboard into a width x width square RGBA image; kings in
+// check are highlighted
 func (board Board) Draw(width int, reverse bool, highlights []Highlight) image.Image {
-	gc, dest := initializeDrawing(width)
-	board.doDraw(gc, reverse, highlights)
-	label(gc, reverse)
+	gc, dest := initializeDrawing(width, 0)
+	board.drawFrom(gc, reverse, highlights)
+	return dest
+}
+
+// viewHighlights adds any checks to the highlights, and moves them all to
+// where they're drawn when the board is turned around for black. Checks are
+// found on the real board, since pawns on a turned one attack the wrong way.
+func (board Board) viewHighlights(reverse bool, highlights []Highlight) []Highlight {
+	highlights = append(board.checkHighlights(), highlights...)
+	if !reverse {
+		return highlights
+	}
+
+	turned := []Highlight{}
+	for _, h := range highlights {
+		h.Row = 9 - h.Row
+		h.Col = 'A' + 'H' - h.Col
+		turned = append(turned, h)
+	}
+	return turned
+}
+
+// drawFrom draws and labels the board, from black's side if reverse is set;
+// that's just the board turned around
+func (board Board) drawFrom(gc draw2d.GraphicContext, reverse bool, highlights []Highlight) {
+	ranks, files := "87654321", "ABCDEFGH"
+	highlights = board.viewHighlights(reverse, highlights)
+
+	if reverse {
+		board = board.Flip().Mirror()
+		ranks, files = "12345678", "HGFEDCBA"
+	}
+
+	board.doDraw(gc, highlights)
+	label(gc, ranks, files)
+}
+
+// DrawEval draws a chessboard like Draw, with an evaluation bar to the right
+// of it showing how far ahead white is
+func (board Board) DrawEval(width int, reverse bool, highlights []Highlight) image.Image {
+	gc, dest := initializeDrawing(width, 8)
+	board.drawFrom(gc, reverse, highlights)
+
+	// the share of the bar that's white, from 0 to 1; 4 pawns up is
+	// about 90%
+	score := float64(board.Evaluate().Score())
+	white := 1 / (1 + math.Pow(10, -score/400))
+
+	gc.SetLineWidth(0)
+	gc.SetFillColor(image.Black)
+	draw2dkit.Rectangle(gc, 82, 0, 86, 80)
+	gc.FillStroke()
+
+	gc.SetFillColor(image.White)
+	if reverse {
+		draw2dkit.Rectangle(gc, 82, 0, 86, 80*white)
+	} else {
+		draw2dkit.Rectangle(gc, 82, 80-80*white, 86, 80)
+	}
+	gc.FillStroke()
+
 	return dest
 }
 
-func (board Board) doDraw(gc draw2d.GraphicContext, reverse bool, highlights []Highlight) {
+// Draw draws the position's board; crazyhouse positions get each side's
+// pocket drawn in a column to the right of the board, so the image is wider
+// than it is tall.
+func (p Position) Draw(width int, reverse bool, highlights []Highlight) image.Image {
+	if p.Variant != VARIANT_CRAZYHOUSE {
+		return p.Board.Draw(width, reverse, highlights)
+	}
+
+	gc, dest := initializeDrawing(width, 20)
+	p.Board.drawFrom(gc, reverse, highlights)
+
+	top, bottom := p.BlackPocket, p.WhitePocket
+	if reverse {
+		top, bottom = bottom, top
+	}
+
+	drawPocket(gc, top, 0)
+	drawPocket(gc, bottom, 40)
+	return dest
+}
+
+// drawPocket draws one pocket as a list of pieces with counts, starting yo
+// units from the top of the board
+func drawPocket(gc draw2d.GraphicContext, pocket string, yo float64) {
+	gc.SetLineWidth(0)
+	gc.SetFillColor(rgb(160, 160, 160))
+	draw2dkit.Rectangle(gc, 82, yo+1, 98, yo+39)
+	gc.FillStroke()
+
+	y := yo + 8
+	for i := 0; i < len(pocketOrder); i++ {
+		n := strings.Count(pocket, pocketOrder[i:i+1])
+		if n == 0 {
+			continue
+		}
+
+		gc.SetFillColor(image.Black)
+		if isWhite(pocketOrder[i]) {
+			gc.SetFillColor(image.White)
+		}
+
+		gc.SetFontSize(7)
+		gc.FillStringAt(AsciiMap[strings.ToUpper(pocketOrder[i:i+1])], 83, y)
+
+		gc.SetFillColor(image.Black)
+		gc.SetFontSize(4)
+		gc.FillStringAt(fmt.Sprintf("%d", n), 93, y-1)
+
+		y += 7.5
+	}
+}
+
+func (board Board) doDraw(gc draw2d.GraphicContext, highlights []Highlight) {
 	gc.SetStrokeColor(&color.RGBA{
 		A: 0,
 	})
@@ -77,10 +207,6 @@ func (board Board) doDraw(gc draw2d.GraphicContext, reverse bool, highlights []H
 
 			yo := float64((8 - r) * 10)
 			xo := float64(col * 10)
-			if reverse {
-				yo = float64((r - 1) * 10)
-				xo = ((7.0 - float64(col)) * 10.0)
-			}
 
 			fill := Dark
 
@@ -92,7 +218,7 @@ func (board Board) doDraw(gc draw2d.GraphicContext, reverse bool, highlights []H
 			for _, v := range highlights {
 				if r == v.Row && c == v.Col {
 					switch v.Kind {
-					case HI_CAPTURED:
+					case HI_CAPTURED, HI_CHECK:
 						gc.SetStrokeColor(Red)
 					case HI_MOVED:
 						fallthrough
@@ -132,56 +258,33 @@ func (board Board) doDraw(gc draw2d.GraphicContext, reverse bool, highlights []H
 	}
 }
 
-func initializeDrawing(width int) (draw2d.GraphicContext, image.Image) {
-	dest := image.NewRGBA(image.Rect(0, 0, (width), (width)))
+// FontFolder is where the "dejavumr.ttf" font pieces are drawn with lives
+var FontFolder = "."
+
+// initializeDrawing sets up a width x width image, plus margin extra units
+// (out of 90) to the right of the board
+func initializeDrawing(width, margin int) (draw2d.GraphicContext, image.Image) {
+	dest := image.NewRGBA(image.Rect(0, 0, width+(width*margin)/90, (width)))
 	gc := draw2dimg.NewGraphicContext(dest)
-	draw2d.SetFontFolder(".")
+	draw2d.SetFontFolder(FontFolder)
 	gc.SetFontData(draw2d.FontData{Name: "dejavu", Family: draw2d.FontFamilyMono})
 	gc.SetFontSize(10)
-	gc.Scale(float64(dest.Bounds().Max.X)/90.0, float64(dest.Bounds().Max.Y)/90.0)
+	gc.Scale(float64(width)/90.0, float64(width)/90.0)
 	gc.Translate(10, 0)
 	return gc, dest
 }
 
-func label(gc draw2d.GraphicContext, reverse bool) {
+// label writes the rank numbers down the side and the file letters along
+// the bottom, top to bottom and left to right
+func label(gc draw2d.GraphicContext, ranks, files string) {
 	gc.SetFillColor(rgb(100, 100, 100))
 	gc.SetFontSize(4)
 
-	if !reverse {
-		gc.FillStringAt("8", -4, 9)
-		gc.FillStringAt("7", -4, 19)
-		gc.FillStringAt("6", -4, 29)
-		gc.FillStringAt("5", -4, 39)
-		gc.FillStringAt("4", -4, 49)
-		gc.FillStringAt("3", -4, 59)
-		gc.FillStringAt("2", -4, 69)
-		gc.FillStringAt("1", -4, 79)
-
-		gc.FillStringAt("A", 2, 85)
-		gc.FillStringAt("B", 12, 85)
-		gc.FillStringAt("C", 22, 85)
-		gc.FillStringAt("D", 32, 85)
-		gc.FillStringAt("E", 42, 85)
-		gc.FillStringAt("F", 52, 85)
-		gc.FillStringAt("G", 62, 85)
-		gc.FillStringAt("H", 72, 85)
-	} else {
-		gc.FillStringAt("1", -4, 9)
-		gc.FillStringAt("2", -4, 19)
-		gc.FillStringAt("3", -4, 29)
-		gc.FillStringAt("4", -4, 39)
-		gc.FillStringAt("5", -4, 49)
-		gc.FillStringAt("6", -4, 59)
-		gc.FillStringAt("7", -4, 69)
-		gc.FillStringAt("8", -4, 79)
-
-		gc.FillStringAt("H", 2, 85)
-		gc.FillStringAt("G", 12, 85)
-		gc.FillStringAt("F", 22, 85)
-		gc.FillStringAt("E", 32, 85)
-		gc.FillStringAt("D", 42, 85)
-		gc.FillStringAt("C", 52, 85)
-		gc.FillStringAt("B", 62, 85)
-		gc.FillStringAt("A", 72, 85)
+	for i := range ranks {
+		gc.FillStringAt(ranks[i:i+1], -4, float64(9+i*10))
+	}
+
+	for i := range files {
+		gc.FillStringAt(files[i:i+1], float64(2+i*10), 85)
 	}
 }
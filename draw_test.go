@@ -0,0 +1,30 @@
+package chess
+
+import "testing"
+
+func TestCheckHighlightsFromBlack(t *testing.T) {
+	// a black pawn on d2 checks the white king on e1
+	p, err := ParseFEN("4k3/8/8/8/8/8/3p4/4K3 w - - 0 1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	moved := Highlight{Kind: HI_MOVED, Row: 2, Col: 'D'}
+	for _, test := range []struct {
+		reverse bool
+		want    []Highlight
+	}{
+		{false, []Highlight{{Kind: HI_CHECK, Row: 1, Col: 'E'}, moved}},
+		{true, []Highlight{{Kind: HI_CHECK, Row: 8, Col: 'D'}, {Kind: HI_MOVED, Row: 7, Col: 'E'}}},
+	} {
+		got := p.Board.viewHighlights(test.reverse, []Highlight{moved})
+		if len(got) != len(test.want) {
+			t.Fatalf("reverse %v: got %v, want %v", test.reverse, got, test.want)
+		}
+		for i := range got {
+			if got[i] != test.want[i] {
+				t.Errorf("reverse %v: got %v, want %v", test.reverse, got, test.want)
+			}
+		}
+	}
+}
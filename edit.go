@@ -0,0 +1,95 @@
+package chess
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Editing positions by hand, for setting up puzzles and lessons. None of
+// these check that the result is legal, since setting up a position goes
+// through plenty of illegal ones (a cleared board has no kings); call
+// Validate when you're done.
+
+// Put places a piece (in Board notation, lowercase for white) on a square,
+// replacing whatever was there
+func (p Position) Put(piece byte, square string) (Position, error) {
+	if !strings.ContainsRune("pnbrqkPNBRQK", rune(piece)) {
+		return p, fmt.Errorf("bad piece '%c'", piece)
+	}
+
+	return p.set(piece, square)
+}
+
+// Remove takes whatever is on a square off the board
+func (p Position) Remove(square string) (Position, error) {
+	return p.set('_', square)
+}
+
+func (p Position) set(piece byte, square string) (Position, error) {
+	i, err := p.Board.Position(square)
+	if err != nil {
+		return p, err
+	}
+
+	p.Board = p.Board.Normalize().Replace(rune(piece), i)
+	p.Promoted &^= 1 << uint(i)
+	p.EnPassant = ""
+	p.Castling = p.possibleCastling(p.Castling)
+	return p, nil
+}
+
+// Clear takes every piece off the board, and empties the pockets
+func (p Position) Clear() Position {
+	p.Board = Board(strings.Repeat("_", 64))
+	p.Promoted = 0
+	p.EnPassant = ""
+	p.Castling = ""
+	p.WhitePocket = ""
+	p.BlackPocket = ""
+	return p
+}
+
+// SetSideToMove sets whose move it is
+func (p Position) SetSideToMove(white bool) Position {
+	p.WhiteToMove = white
+	p.EnPassant = ""
+	return p
+}
+
+// SetCastling sets castling rights, as in FEN ("KQkq", "Kq", "" or "-");
+// each right needs its king and rook on their starting squares
+func (p Position) SetCastling(rights string) (Position, error) {
+	if rights == "-" {
+		rights = ""
+	}
+
+	for _, c := range rights {
+		if !strings.ContainsRune("KQkq", c) {
+			return p, fmt.Errorf("bad castling right '%c'", c)
+		}
+	}
+
+	possible := p.possibleCastling(rights)
+	for _, c := range rights {
+		if !strings.ContainsRune(possible, c) {
+			return p, fmt.Errorf("can't castle %c without the king and rook on their starting squares", c)
+		}
+	}
+
+	p.Castling = possible
+	return p, nil
+}
+
+// possibleCastling returns the rights, out of rights, that the king and rook
+// positions still allow
+func (p Position) possibleCastling(rights string) string {
+	possible := PositionFromBoard(p.Board, p.WhiteToMove).Castling
+
+	ret := ""
+	for _, c := range "KQkq" {
+		if strings.ContainsRune(rights, c) && strings.ContainsRune(possible, c) {
+			ret += string(c)
+		}
+	}
+	return ret
+}
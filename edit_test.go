@@ -0,0 +1,84 @@
+package chess
+
+import "testing"
+
+func TestEdit(t *testing.T) {
+	p := StartingPosition(VARIANT_STANDARD)
+
+	// taking a rook away loses its castling right
+	p, err := p.Remove("h1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Castling != "Qkq" {
+		t.Errorf("without the h1 rook, castling is %q", p.Castling)
+	}
+
+	// putting it back doesn't get the right back
+	if p, err = p.Put('r', "H1"); err != nil {
+		t.Fatal(err)
+	}
+	if p.Castling != "Qkq" || p.Board[indexFromCoords(1, 7)] != 'r' {
+		t.Errorf("after putting the rook back: %s", p.FEN())
+	}
+
+	if p, err = p.SetCastling("KQkq"); err != nil || p.FEN() != StartingPosition(VARIANT_STANDARD).FEN() {
+		t.Errorf("setting castling back: %s (%v)", p.FEN(), err)
+	}
+
+	// a piece replaces what was there
+	if p, err = p.Put('Q', "e2"); err != nil {
+		t.Fatal(err)
+	}
+	if p.Board[indexFromCoords(2, 4)] != 'Q' {
+		t.Errorf("e2 is %c", p.Board[indexFromCoords(2, 4)])
+	}
+
+	if _, err := p.Put('x', "e2"); err == nil {
+		t.Error("put an x on the board")
+	}
+	for _, square := range []string{"i1", "e9", ""} {
+		if _, err := p.Put('Q', square); err == nil {
+			t.Errorf("put a queen on %q", square)
+		}
+		if _, err := p.Remove(square); err == nil {
+			t.Errorf("removed a piece from %q", square)
+		}
+	}
+
+	p = p.Clear()
+	if p.FEN() != "8/8/8/8/8/8/8/8 w - - 0 1" {
+		t.Errorf("cleared board is %s", p.FEN())
+	}
+	if p.Validate() == nil {
+		t.Error("an empty board is legal")
+	}
+
+	p, _ = p.Put('k', "e1")
+	p, _ = p.Put('K', "e8")
+	p = p.SetSideToMove(false)
+	if err := p.Validate(); err != nil || p.WhiteToMove {
+		t.Errorf("two kings, black to move: %s (%v)", p.FEN(), err)
+	}
+}
+
+func TestSetCastling(t *testing.T) {
+	p, _ := ParseFEN("r3k2r/8/8/8/8/8/8/4K2R w - - 0 1")
+
+	for rights, want := range map[string]string{
+		"K":    "K",
+		"kqK":  "Kkq",
+		"-":    "",
+		"":     "",
+		"KQkq": "error",
+		"KX":   "error",
+	} {
+		got, err := p.SetCastling(rights)
+		switch {
+		case want == "error" && err == nil:
+			t.Errorf("%q gave %q", rights, got.Castling)
+		case want != "error" && (err != nil || got.Castling != want):
+			t.Errorf("%q gave %q (%v), not %q", rights, got.Castling, err, want)
+		}
+	}
+}
@@ -0,0 +1,174 @@
+package chess
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// EPD is FEN without the move counters, followed by opcodes like
+// `bm Qg6; id "WAC.001";`. Test suites are files of these, one per line.
+
+// An EPD is a position and its opcodes
+type EPD struct {
+	Position Position
+
+	// Ops maps each opcode to its operands, with quotes taken off
+	Ops map[string][]string
+}
+
+// ParseEPD parses one line of EPD
+func ParseEPD(line string) (EPD, error) {
+	e := EPD{
+		Ops: map[string][]string{},
+	}
+
+	fields := strings.Fields(line)
+	if len(fields) < 4 {
+		return e, fmt.Errorf("EPD needs a board, side to move, castling and en passant")
+	}
+
+	p, err := ParseFEN(strings.Join(fields[:4], " "))
+	if err != nil {
+		return e, err
+	}
+	e.Position = p
+
+	// the opcodes start after the fourth field
+	rest := line
+	for i := 0; i < 4; i++ {
+		rest = strings.TrimLeft(rest, " \t")
+		rest = rest[len(fields[i]):]
+	}
+
+	for _, op := range splitOps(rest) {
+		if len(op) == 0 {
+			continue
+		}
+		e.Ops[op[0]] = op[1:]
+	}
+
+	if hmvc, ok := e.Ops["hmvc"]; ok && len(hmvc) > 0 {
+		fmt.Sscanf(hmvc[0], "%d", &e.Position.HalfMoves)
+	}
+	if fmvn, ok := e.Ops["fmvn"]; ok && len(fmvn) > 0 {
+		fmt.Sscanf(fmvn[0], "%d", &e.Position.FullMoves)
+	}
+
+	return e, nil
+}
+
+// splitOps splits EPD opcodes into words, one list per opcode; semicolons
+// and spaces inside quotes don't count
+func splitOps(s string) (ops [][]string) {
+	op := []string{}
+	word := &strings.Builder{}
+	quoted, inWord := false, false
+
+	endWord := func() {
+		if inWord {
+			op = append(op, word.String())
+			word.Reset()
+			inWord = false
+		}
+	}
+
+	for _, c := range s {
+		switch {
+		case c == '"':
+			quoted = !quoted
+			inWord = true
+		case quoted:
+			word.WriteRune(c)
+		case c == ';':
+			endWord()
+			ops = append(ops, op)
+			op = []string{}
+		case c == ' ' || c == '\t':
+			endWord()
+		default:
+			word.WriteRune(c)
+			inWord = true
+		}
+	}
+
+	endWord()
+	if len(op) > 0 {
+		ops = append(ops, op)
+	}
+
+	return
+}
+
+// ID returns the "id" opcode
+func (e EPD) ID() string {
+	return strings.Join(e.Ops["id"], " ")
+}
+
+// Comment returns the "c0" opcode
+func (e EPD) Comment() string {
+	return strings.Join(e.Ops["c0"], " ")
+}
+
+// BestMoves returns the "bm" opcode's moves, in SAN
+func (e EPD) BestMoves() []string {
+	return e.Ops["bm"]
+}
+
+// AvoidMoves returns the "am" opcode's moves, in SAN
+func (e EPD) AvoidMoves() []string {
+	return e.Ops["am"]
+}
+
+// Solved reports whether a move, in the form Moves uses, is one of the best
+// moves and none of the moves to avoid
+func (e EPD) Solved(move string) bool {
+	san, err := e.Position.SAN(move)
+	if err != nil {
+		return false
+	}
+	san = stripSAN(san)
+
+	for _, am := range e.AvoidMoves() {
+		if stripSAN(am) == san {
+			return false
+		}
+	}
+
+	if len(e.BestMoves()) == 0 {
+		return len(e.AvoidMoves()) > 0
+	}
+
+	for _, bm := range e.BestMoves() {
+		if stripSAN(bm) == san {
+			return true
+		}
+	}
+
+	return false
+}
+
+// String writes the EPD back out, opcodes in alphabetical order
+func (e EPD) String() string {
+	fen := strings.Fields(e.Position.FEN())
+	out := strings.Join(fen[:4], " ")
+
+	keys := []string{}
+	for k := range e.Ops {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		out += " " + k
+		for _, v := range e.Ops[k] {
+			if strings.ContainsAny(v, " ;") || k == "id" || (len(k) == 2 && k[0] == 'c') {
+				v = `"` + v + `"`
+			}
+			out += " " + v
+		}
+		out += ";"
+	}
+
+	return out
+}
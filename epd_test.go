@@ -0,0 +1,58 @@
+package chess
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseEPD(t *testing.T) {
+	e, err := ParseEPD(`2rr3k/pp3pp1/1nnqbN1p/3pN3/2pP4/2P3Q1/PPB4P/R4RK1 w - - bm Qg6; id "WAC.001"; c0 "mate in 3; 1. Qg6";`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if e.ID() != "WAC.001" || e.Comment() != "mate in 3; 1. Qg6" {
+		t.Errorf("id %q, comment %q", e.ID(), e.Comment())
+	}
+	if !reflect.DeepEqual(e.BestMoves(), []string{"Qg6"}) || len(e.AvoidMoves()) != 0 {
+		t.Errorf("bm %v, am %v", e.BestMoves(), e.AvoidMoves())
+	}
+	if !e.Position.WhiteToMove || e.Position.Board.Normalize() != e.Position.Board {
+		t.Errorf("position is %s", e.Position.FEN())
+	}
+
+	if !e.Solved("G3-G6") || !e.Solved("G3-G6") || e.Solved("F6-H7") || e.Solved("E9-E10") {
+		t.Error("Solved is wrong about Qg6")
+	}
+
+	if got := e.String(); got != `2rr3k/pp3pp1/1nnqbN1p/3pN3/2pP4/2P3Q1/PPB4P/R4RK1 w - - bm Qg6; c0 "mate in 3; 1. Qg6"; id "WAC.001";` {
+		t.Errorf("wrote it back as %s", got)
+	}
+
+	// move counters, several best moves, and an avoid-move on its own
+	e, err = ParseEPD("rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - bm e4 d4; hmvc 3; fmvn 12;")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e.Position.HalfMoves != 3 || e.Position.FullMoves != 12 {
+		t.Errorf("counters are %d and %d", e.Position.HalfMoves, e.Position.FullMoves)
+	}
+	if !e.Solved("E2-E4") || !e.Solved("D2-D4") || e.Solved("G1-F3") {
+		t.Error("Solved is wrong about e4 and d4")
+	}
+
+	e, _ = ParseEPD("rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - am f3;")
+	if e.Solved("F2-F3") || !e.Solved("E2-E4") {
+		t.Error("Solved is wrong about avoiding f3")
+	}
+
+	for _, line := range []string{
+		"",
+		"rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq",
+		"rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP w KQkq - bm e4;",
+	} {
+		if _, err := ParseEPD(line); err == nil {
+			t.Errorf("%q shouldn't parse", line)
+		}
+	}
+}
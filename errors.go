@@ -0,0 +1,74 @@
+package chess
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Errors for moves the rules don't allow, so callers can use errors.As to
+// find out why instead of parsing strings.
+
+// Reasons a move is illegal
+const (
+	ILLEGAL_NO_PIECE = iota
+	ILLEGAL_WRONG_SIDE
+	ILLEGAL_CANT_MOVE_THERE
+	ILLEGAL_LEAVES_CHECK
+	ILLEGAL_CASTLING
+	ILLEGAL_DROP
+	ILLEGAL_NO_MATCH
+)
+
+// An IllegalMoveError is a move that's understood but not allowed
+type IllegalMoveError struct {
+	// Move is the move as it was given
+	Move string
+
+	// Reason is one of the ILLEGAL_ constants
+	Reason int
+
+	// Text explains the problem to a human
+	Text string
+}
+
+func (e *IllegalMoveError) Error() string {
+	return e.Text
+}
+
+func illegal(move string, reason int, format string, args ...interface{}) error {
+	return &IllegalMoveError{
+		Move:   move,
+		Reason: reason,
+		Text:   fmt.Sprintf(format, args...),
+	}
+}
+
+// An AmbiguousMoveError is an algebraic move that more than one piece can
+// make; Candidates are the unambiguous ways to write it, like "Nbd2"
+type AmbiguousMoveError struct {
+	Move       string
+	Candidates []string
+}
+
+func (e *AmbiguousMoveError) Error() string {
+	return fmt.Sprintf("ambiguous move: %s could be %s", e.Move, strings.Join(e.Candidates, " or "))
+}
+
+// A SquareError is a square name that doesn't make sense, like "J9"
+type SquareError struct {
+	Square string
+	Text   string
+}
+
+func (e *SquareError) Error() string {
+	return e.Text
+}
+
+// A NotationError is a move that can't be parsed at all
+type NotationError struct {
+	Move string
+}
+
+func (e *NotationError) Error() string {
+	return fmt.Sprintf("invalid notation: %s", e.Move)
+}
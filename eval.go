@@ -0,0 +1,291 @@
+package chess
+
+import (
+	"bytes"
+	"fmt"
+)
+
+// A static evaluation: a score in centipawns from white's point of view
+// (positive is good for white), broken down into the terms that make it up
+// so a human can see why.
+
+// An Evaluation is a score broken down by term; each term is white's
+// score minus black's
+type Evaluation struct {
+	Material      int
+	PieceSquare   int
+	Mobility      int
+	KingSafety    int
+	PawnStructure int
+
+	// Doubled, Isolated and Passed count pawns for white and black
+	// (index 0 is white)
+	Doubled  [2]int
+	Isolated [2]int
+	Passed   [2]int
+}
+
+// Score is the total of all the terms
+func (e Evaluation) Score() int {
+	return e.Material + e.PieceSquare + e.Mobility + e.KingSafety + e.PawnStructure
+}
+
+// Piece-square tables, from white's side of the board with index 0 at A8
+// like Board. Black reads them upside down.
+var pieceSquare = map[byte][64]int{
+	'P': {
+		0, 0, 0, 0, 0, 0, 0, 0,
+		50, 50, 50, 50, 50, 50, 50, 50,
+		10, 10, 20, 30, 30, 20, 10, 10,
+		5, 5, 10, 25, 25, 10, 5, 5,
+		0, 0, 0, 20, 20, 0, 0, 0,
+		5, -5, -10, 0, 0, -10, -5, 5,
+		5, 10, 10, -20, -20, 10, 10, 5,
+		0, 0, 0, 0, 0, 0, 0, 0,
+	},
+	'N': {
+		-50, -40, -30, -30, -30, -30, -40, -50,
+		-40, -20, 0, 0, 0, 0, -20, -40,
+		-30, 0, 10, 15, 15, 10, 0, -30,
+		-30, 5, 15, 20, 20, 15, 5, -30,
+		-30, 0, 15, 20, 20, 15, 0, -30,
+		-30, 5, 10, 15, 15, 10, 5, -30,
+		-40, -20, 0, 5, 5, 0, -20, -40,
+		-50, -40, -30, -30, -30, -30, -40, -50,
+	},
+	'B': {
+		-20, -10, -10, -10, -10, -10, -10, -20,
+		-10, 0, 0, 0, 0, 0, 0, -10,
+		-10, 0, 5, 10, 10, 5, 0, -10,
+		-10, 5, 5, 10, 10, 5, 5, -10,
+		-10, 0, 10, 10, 10, 10, 0, -10,
+		-10, 10, 10, 10, 10, 10, 10, -10,
+		-10, 5, 0, 0, 0, 0, 5, -10,
+		-20, -10, -10, -10, -10, -10, -10, -20,
+	},
+	'R': {
+		0, 0, 0, 0, 0, 0, 0, 0,
+		5, 10, 10, 10, 10, 10, 10, 5,
+		-5, 0, 0, 0, 0, 0, 0, -5,
+		-5, 0, 0, 0, 0, 0, 0, -5,
+		-5, 0, 0, 0, 0, 0, 0, -5,
+		-5, 0, 0, 0, 0, 0, 0, -5,
+		-5, 0, 0, 0, 0, 0, 0, -5,
+		0, 0, 0, 5, 5, 0, 0, 0,
+	},
+	'Q': {
+		-20, -10, -10, -5, -5, -10, -10, -20,
+		-10, 0, 0, 0, 0, 0, 0, -10,
+		-10, 0, 5, 5, 5, 5, 0, -10,
+		-5, 0, 5, 5, 5, 5, 0, -5,
+		0, 0, 5, 5, 5, 5, 0, -5,
+		-10, 5, 5, 5, 5, 5, 0, -10,
+		-10, 0, 5, 0, 0, 0, 0, -10,
+		-20, -10, -10, -5, -5, -10, -10, -20,
+	},
+	'K': {
+		-30, -40, -40, -50, -50, -40, -40, -30,
+		-30, -40, -40, -50, -50, -40, -40, -30,
+		-30, -40, -40, -50, -50, -40, -40, -30,
+		-30, -40, -40, -50, -50, -40, -40, -30,
+		-20, -30, -30, -40, -40, -30, -30, -20,
+		-10, -20, -20, -20, -20, -20, -20, -10,
+		20, 20, 0, 0, 0, 0, 20, 20,
+		20, 30, 10, 0, 0, 10, 30, 20,
+	},
+}
+
+// Weights for the terms that aren't tables
+const (
+	MOBILITY_WEIGHT    = 4
+	SHIELD_BONUS       = 10
+	KING_ATTACK_WEIGHT = 8
+	DOUBLED_PENALTY    = 20
+	ISOLATED_PENALTY   = 15
+	PASSED_BONUS       = 20
+)
+
+// sign is +1 for white and -1 for black, so terms can be summed as
+// white minus black
+func sign(white bool) int {
+	if white {
+		return 1
+	}
+	return -1
+}
+
+func side(white bool) int {
+	if white {
+		return 0
+	}
+	return 1
+}
+
+// Evaluate scores a board statically, without searching
+func (board Board) Evaluate() Evaluation {
+	e := Evaluation{}
+
+	// pawns[side][col] counts pawns on each file
+	pawns := [2][8]int{}
+
+	for i := 0; i < len(board); i++ {
+		piece := board[i]
+		if piece == '_' {
+			continue
+		}
+
+		white := isWhite(piece)
+		upper := piece
+		sq := i
+		if white {
+			upper -= 32
+		} else {
+			// black reads the table upside down
+			sq = 56 - 8*(i/8) + i%8
+		}
+
+		e.Material += sign(white) * pieceValue(piece)
+		e.PieceSquare += sign(white) * pieceSquare[upper][sq]
+
+		if upper == 'P' {
+			pawns[side(white)][i%8]++
+		} else if upper != 'K' {
+			e.Mobility += sign(white) * MOBILITY_WEIGHT * len(board.validMoves(i))
+		}
+	}
+
+	for _, white := range []bool{true, false} {
+		e.KingSafety += sign(white) * board.kingSafety(white)
+		e.PawnStructure += sign(white) * board.pawnStructure(white, pawns, &e)
+	}
+
+	return e
+}
+
+// kingSafety rewards pawns in front of the king and penalizes enemy attacks
+// on the squares around it
+func (board Board) kingSafety(white bool) (score int) {
+	k := board.king(white)
+	if k == -1 {
+		return 0
+	}
+
+	row, col := coordsFromIndex(k)
+	ahead := 1
+	if !white {
+		ahead = -1
+	}
+
+	for c := col - 1; c <= col+1; c++ {
+		for _, r := range []int{row + ahead, row + 2*ahead} {
+			if onBoard(r, c) && board[indexFromCoords(r, c)] == pieceOf('P', white) {
+				score += SHIELD_BONUS
+				break
+			}
+		}
+	}
+
+	for _, s := range kingSteps {
+		if onBoard(row+s.row, col+s.col) {
+			score -= KING_ATTACK_WEIGHT * len(board.attackers(indexFromCoords(row+s.row, col+s.col), !white))
+		}
+	}
+
+	return
+}
+
+// pawnStructure scores doubled, isolated and passed pawns, counting them
+// into e as it goes
+func (board Board) pawnStructure(white bool, pawns [2][8]int, e *Evaluation) (score int) {
+	us, them := side(white), side(!white)
+
+	for col := 0; col < 8; col++ {
+		if pawns[us][col] > 1 {
+			e.Doubled[us] += pawns[us][col] - 1
+			score -= DOUBLED_PENALTY * (pawns[us][col] - 1)
+		}
+	}
+
+	for i := 0; i < len(board); i++ {
+		if board[i] != pieceOf('P', white) {
+			continue
+		}
+
+		row, col := coordsFromIndex(i)
+
+		if (col == 0 || pawns[us][col-1] == 0) && (col == 7 || pawns[us][col+1] == 0) {
+			e.Isolated[us]++
+			score -= ISOLATED_PENALTY
+		}
+
+		// passed if no enemy pawn ahead on this file or either next to it
+		passed := true
+		for c := col - 1; c <= col+1 && passed; c++ {
+			if c < 0 || c > 7 || pawns[them][c] == 0 {
+				continue
+			}
+			for r := row + sign(white); r >= 1 && r <= 8; r += sign(white) {
+				if board[indexFromCoords(r, c)] == pieceOf('P', !white) {
+					passed = false
+					break
+				}
+			}
+		}
+
+		if passed {
+			e.Passed[us]++
+			// further up the board is worth more
+			advanced := row - 2
+			if !white {
+				advanced = 7 - row
+			}
+			score += PASSED_BONUS + PASSED_BONUS*advanced/2
+		}
+	}
+
+	return
+}
+
+// InsufficientMaterial reports whether a side can't possibly give mate: a
+// bare king, or a king and a single bishop or knight. Helpmates with the
+// other side's pieces in the way aren't considered, same as most servers
+// deciding whether running out of time loses.
+func (board Board) InsufficientMaterial(white bool) bool {
+	board = board.Normalize()
+
+	minors := 0
+	for i := 0; i < 64; i++ {
+		piece := board[i]
+		if piece == '_' || isWhite(piece) != white {
+			continue
+		}
+
+		switch piece {
+		case pieceOf('K', white):
+		case pieceOf('B', white), pieceOf('N', white):
+			minors++
+		default:
+			return false
+		}
+	}
+	return minors < 2
+}
+
+// String prints the breakdown, one term per line, in pawns
+func (e Evaluation) String() string {
+	out := &bytes.Buffer{}
+
+	pawns := func(cp int) string {
+		return fmt.Sprintf("%+.2f", float64(cp)/100)
+	}
+
+	fmt.Fprintf(out, "Material: %s\n", pawns(e.Material))
+	fmt.Fprintf(out, "Piece placement: %s\n", pawns(e.PieceSquare))
+	fmt.Fprintf(out, "Mobility: %s\n", pawns(e.Mobility))
+	fmt.Fprintf(out, "King safety: %s\n", pawns(e.KingSafety))
+	fmt.Fprintf(out, "Pawn structure: %s (doubled %d/%d, isolated %d/%d, passed %d/%d)\n", pawns(e.PawnStructure),
+		e.Doubled[0], e.Doubled[1], e.Isolated[0], e.Isolated[1], e.Passed[0], e.Passed[1])
+	fmt.Fprintf(out, "Total: %s", pawns(e.Score()))
+
+	return out.String()
+}
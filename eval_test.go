@@ -0,0 +1,80 @@
+package chess
+
+import "testing"
+
+func TestEvaluateStart(t *testing.T) {
+	if e := StartingBoard.Normalize().Evaluate(); e != (Evaluation{Doubled: e.Doubled, Isolated: e.Isolated, Passed: e.Passed}) || e.Score() != 0 {
+		t.Errorf("the starting position isn't even:\n%s", e)
+	}
+}
+
+// swapping the colors turns the board around, so every term should just
+// change sign
+func TestEvaluateSymmetric(t *testing.T) {
+	for seed := int64(1); seed <= 20; seed++ {
+		_, p := RandomGame(seed, int(seed)*3)
+
+		e, swapped := p.Board.Evaluate(), p.Board.SwapColors().Evaluate()
+		if e.Material != -swapped.Material || e.PieceSquare != -swapped.PieceSquare || e.Mobility != -swapped.Mobility ||
+			e.KingSafety != -swapped.KingSafety || e.PawnStructure != -swapped.PawnStructure {
+			t.Errorf("%s:\n%s\nbut with the colors swapped:\n%s", p.FEN(), e, swapped)
+		}
+
+		if e.Doubled != [2]int{swapped.Doubled[1], swapped.Doubled[0]} || e.Passed != [2]int{swapped.Passed[1], swapped.Passed[0]} {
+			t.Errorf("%s: pawn counts changed with the colors swapped", p.FEN())
+		}
+	}
+}
+
+func TestEvaluateTerms(t *testing.T) {
+	for _, test := range []struct {
+		fen                       string
+		material                  int
+		doubled, isolated, passed [2]int
+	}{
+		// black's missing a queen
+		{"rnb1kbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1", 900, [2]int{}, [2]int{}, [2]int{}},
+		// white's c pawns are doubled, isolated and passed; black's h
+		// pawn is isolated but blocked from passing by the g pawn
+		{"4k3/8/8/7p/6P1/2P5/2P5/4K3 w - - 0 1", 200, [2]int{1, 0}, [2]int{3, 1}, [2]int{2, 0}},
+		// connected passers
+		{"4k3/8/3PP3/8/8/8/8/4K3 w - - 0 1", 200, [2]int{}, [2]int{}, [2]int{2, 0}},
+	} {
+		p, err := ParseFEN(test.fen)
+		if err != nil {
+			t.Fatalf("%s: %s", test.fen, err)
+		}
+
+		e := p.Board.Evaluate()
+		if e.Material != test.material || e.Doubled != test.doubled || e.Isolated != test.isolated || e.Passed != test.passed {
+			t.Errorf("%s:\n%s", test.fen, e)
+		}
+	}
+}
+
+func TestInsufficientMaterial(t *testing.T) {
+	for _, test := range []struct {
+		fen          string
+		white, black bool
+	}{
+		{"4k3/8/8/8/8/8/8/4K3 w - - 0 1", true, true},
+		{"4k3/8/8/8/8/8/8/2B1K3 w - - 0 1", true, true},
+		{"4k3/8/8/8/8/8/8/1N2K3 w - - 0 1", true, true},
+		// two minors can mate (or could, with help)
+		{"4k3/8/8/8/8/8/8/1NB1K3 w - - 0 1", false, true},
+		{"4k3/8/8/8/8/8/8/1NN1K3 w - - 0 1", false, true},
+		// a pawn can queen, and a rook mates on its own
+		{"4k3/8/8/8/8/8/P7/4K3 w - - 0 1", false, true},
+		{"4k3/8/8/8/8/8/8/4K2r b - - 0 1", true, false},
+		{"rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1", false, false},
+	} {
+		p, err := ParseFEN(test.fen)
+		if err != nil {
+			t.Fatalf("%s: %s", test.fen, err)
+		}
+
+		if white, black := p.Board.InsufficientMaterial(true), p.Board.InsufficientMaterial(false); white != test.white || black != test.black {
+			t.Errorf("%s: white %v, black %v", test.fen, white, black)
+		}
+	}
+}
@@ -0,0 +1,188 @@
+package chess
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// FEN uses uppercase for white and lowercase for black, which is backwards
+// from Board, so everything gets its case swapped on the way in and out.
+
+func swapCase(r rune) rune {
+	switch {
+	case r >= 'a' && r <= 'z':
+		return r - 32
+	case r >= 'A' && r <= 'Z':
+		return r + 32
+	}
+	return r
+}
+
+// ParseFEN parses a FEN string into a Position. Crazyhouse pockets can be
+// given in brackets after the board ("...RNBQKBNR[Qn] w KQkq - 0 1") or as
+// a ninth rank ("...RNBQKBNR/Qn w KQkq - 0 1"); promoted pieces are marked
+// with a "~" after them. The move counters are optional.
+func ParseFEN(fen string) (Position, error) {
+	p := Position{
+		FullMoves: 1,
+	}
+
+	fields := strings.Fields(fen)
+	if len(fields) < 2 {
+		return p, fmt.Errorf("FEN needs at least a board and a side to move")
+	}
+
+	placement := fields[0]
+	pocket := ""
+	hasPocket := false
+
+	if i := strings.Index(placement, "["); i != -1 {
+		if !strings.HasSuffix(placement, "]") {
+			return p, fmt.Errorf("unterminated pocket in FEN")
+		}
+		pocket = placement[i+1 : len(placement)-1]
+		placement = placement[:i]
+		hasPocket = true
+	}
+
+	ranks := strings.Split(placement, "/")
+	if len(ranks) == 9 {
+		pocket = ranks[8]
+		ranks = ranks[:8]
+		hasPocket = true
+	}
+
+	if len(ranks) != 8 {
+		return p, fmt.Errorf("FEN board has %d ranks", len(ranks))
+	}
+
+	board := []byte{}
+	for r, rank := range ranks {
+		for _, c := range rank {
+			switch {
+			case c >= '1' && c <= '8':
+				board = append(board, bytes.Repeat([]byte("_"), int(c-'0'))...)
+			case c == '~':
+				if len(board) == 0 {
+					return p, fmt.Errorf("promotion marker with no piece")
+				}
+				p.Promoted |= 1 << uint(len(board)-1)
+			case strings.ContainsRune("pnbrqkPNBRQK", c):
+				board = append(board, byte(swapCase(c)))
+			default:
+				return p, fmt.Errorf("bad piece '%c' in FEN", c)
+			}
+		}
+
+		if len(board) != (r+1)*8 {
+			return p, fmt.Errorf("FEN rank %d isn't 8 squares", 8-r)
+		}
+	}
+	p.Board = Board(board)
+
+	if hasPocket {
+		p.Variant = VARIANT_CRAZYHOUSE
+		for _, c := range pocket {
+			switch {
+			case strings.ContainsRune("PNBRQ", c):
+				p.WhitePocket += string(swapCase(c))
+			case strings.ContainsRune("pnbrq", c):
+				p.BlackPocket += string(swapCase(c))
+			case c == '-':
+			default:
+				return p, fmt.Errorf("bad piece '%c' in FEN pocket", c)
+			}
+		}
+		p.WhitePocket = sortPocket(p.WhitePocket)
+		p.BlackPocket = sortPocket(p.BlackPocket)
+	}
+
+	switch fields[1] {
+	case "w":
+		p.WhiteToMove = true
+	case "b":
+	default:
+		return p, fmt.Errorf("bad side to move '%s' in FEN", fields[1])
+	}
+
+	if len(fields) > 2 && fields[2] != "-" {
+		for _, c := range fields[2] {
+			if !strings.ContainsRune("KQkq", c) {
+				return p, fmt.Errorf("bad castling rights '%s' in FEN", fields[2])
+			}
+		}
+		p.Castling = fields[2]
+	}
+
+	if len(fields) > 3 && fields[3] != "-" {
+		if _, err := p.Board.Position(fields[3]); err != nil || len(fields[3]) != 2 {
+			return p, fmt.Errorf("bad en passant square '%s' in FEN", fields[3])
+		}
+		p.EnPassant = strings.ToUpper(fields[3])
+	}
+
+	var err error
+	if len(fields) > 4 {
+		if p.HalfMoves, err = strconv.Atoi(fields[4]); err != nil {
+			return p, fmt.Errorf("bad halfmove clock '%s' in FEN", fields[4])
+		}
+	}
+
+	if len(fields) > 5 {
+		if p.FullMoves, err = strconv.Atoi(fields[5]); err != nil {
+			return p, fmt.Errorf("bad move number '%s' in FEN", fields[5])
+		}
+	}
+
+	return p, nil
+}
+
+// FEN returns the position as a FEN string, with a bracketed pocket if this
+// is a crazyhouse game
+func (p Position) FEN() string {
+	out := &bytes.Buffer{}
+
+	for i := 0; i < 64; i++ {
+		if i != 0 && i%8 == 0 {
+			out.WriteString("/")
+		}
+
+		if p.Board[i] == '_' {
+			n := 1
+			for ; i+1 < 64 && (i+1)%8 != 0 && p.Board[i+1] == '_'; i++ {
+				n++
+			}
+			fmt.Fprintf(out, "%d", n)
+			continue
+		}
+
+		out.WriteRune(swapCase(rune(p.Board[i])))
+		if p.Variant == VARIANT_CRAZYHOUSE && p.Promoted&(1<<uint(i)) != 0 {
+			out.WriteString("~")
+		}
+	}
+
+	if p.Variant == VARIANT_CRAZYHOUSE {
+		fmt.Fprintf(out, "[%s]", strings.Map(swapCase, p.WhitePocket+p.BlackPocket))
+	}
+
+	side := "b"
+	if p.WhiteToMove {
+		side = "w"
+	}
+
+	castling := p.Castling
+	if castling == "" {
+		castling = "-"
+	}
+
+	ep := strings.ToLower(p.EnPassant)
+	if ep == "" {
+		ep = "-"
+	}
+
+	fmt.Fprintf(out, " %s %s %s %d %d", side, castling, ep, p.HalfMoves, p.FullMoves)
+	return out.String()
+}
@@ -0,0 +1,213 @@
+package chess
+
+import (
+	"strings"
+	"testing"
+)
+
+// Fuzz targets for everything that takes squares or moves from users. Each
+// one starts from a random game, so the same seed corpus covers positions
+// deep into a game as well as the opening. Run them with, for instance,
+// "go test -fuzz FuzzMove".
+
+// fuzzPosition is the position after a random game of up to 80 plies
+func fuzzPosition(seed int64, plies uint8) Position {
+	_, p := RandomGame(seed, int(plies)%80)
+	return p
+}
+
+func FuzzPosition(f *testing.F) {
+	for _, s := range []string{"e4", "H8", "a1x", "i1", "a9", "", "e", "\xff\xff"} {
+		f.Add(s)
+	}
+
+	f.Fuzz(func(t *testing.T, s string) {
+		i, err := StartingBoard.Position(s)
+		if err != nil {
+			return
+		}
+
+		if i < 0 || i >= 64 {
+			t.Fatalf("%q is square %d", s, i)
+		}
+
+		if name := indexName(i); name != strings.ToUpper(s[:2]) {
+			t.Fatalf("%q is square %d, which is %s", s, i, name)
+		}
+
+		col, row, err := StartingBoard.Coord(s)
+		if err != nil || indexFromCoords(row, int(col-'A')) != i {
+			t.Fatalf("%q: Coord says %c%d (%v), Position says %s", s, col, row, err, indexName(i))
+		}
+	})
+}
+
+func FuzzAlgebraic(f *testing.F) {
+	f.Add(int64(1), uint8(0), "Nf3", true)
+	f.Add(int64(2), uint8(10), "exd5", false)
+	f.Add(int64(3), uint8(30), "O-O", true)
+	f.Add(int64(4), uint8(41), "Qh4xe1", false)
+
+	f.Fuzz(func(t *testing.T, seed int64, plies uint8, move string, white bool) {
+		board := fuzzPosition(seed, plies).Board
+
+		src, dst, err := board.Algebraic(move, white)
+		if err != nil {
+			return
+		}
+
+		if _, err := board.Position(src); err != nil {
+			t.Fatalf("%s: %q gave a bad source square %q", board, move, src)
+		}
+		if _, err := board.Position(dst); err != nil {
+			t.Fatalf("%s: %q gave a bad destination square %q", board, move, dst)
+		}
+	})
+}
+
+func FuzzCoordsToAlgebraic(f *testing.F) {
+	f.Add(int64(1), uint8(0), "G1", "F3")
+	f.Add(int64(2), uint8(12), "e2", "e4")
+	f.Add(int64(3), uint8(25), "B1", "D2")
+	f.Add(int64(4), uint8(7), "A1", "")
+
+	f.Fuzz(func(t *testing.T, seed int64, plies uint8, src, dst string) {
+		board := fuzzPosition(seed, plies).Board
+
+		alg, err := board.CoordsToAlgebraic(src, dst)
+		if err != nil {
+			return
+		}
+
+		i, _ := board.Position(src)
+		from, to, err := board.Algebraic(alg, isWhite(board[i]))
+		if err != nil {
+			t.Fatalf("%s: %s-%s is %s, which doesn't parse: %s", board, src, dst, alg, err)
+		}
+
+		if !strings.EqualFold(from, src[:2]) || !strings.EqualFold(to, dst[:2]) {
+			t.Fatalf("%s: %s-%s is %s, which is %s-%s", board, src, dst, alg, from, to)
+		}
+	})
+}
+
+// checkRules checks a move from the move list against the rules, without
+// asking the move generator: nothing but a knight jumps, nobody takes their
+// own pieces, and pawns only go diagonally to take something
+func checkRules(t *testing.T, p Position, move string) {
+	if DropRx.MatchString(move) {
+		return
+	}
+
+	src, dst, _, err := p.splitMove(move)
+	if err != nil {
+		t.Fatalf("%s: %s is in the move list but doesn't parse: %s", p.FEN(), move, err)
+	}
+
+	piece, target := p.Board[src], p.Board[dst]
+	if target != '_' && p.ours(target) {
+		t.Fatalf("%s: %s takes its own piece", p.FEN(), move)
+	}
+
+	sr, sc := coordsFromIndex(src)
+	dr, dc := coordsFromIndex(dst)
+	rowStep, colStep := step(dr-sr), step(dc-sc)
+
+	if piece != 'n' && piece != 'N' {
+		if dr != sr && dc != sc && dr-sr != dc-sc && dr-sr != sc-dc {
+			t.Fatalf("%s: %c moves %s, which isn't in a line", p.FEN(), piece, move)
+		}
+
+		for r, c := sr+rowStep, sc+colStep; r != dr || c != dc; r, c = r+rowStep, c+colStep {
+			if p.Board[indexFromCoords(r, c)] != '_' {
+				t.Fatalf("%s: %s jumps over %c", p.FEN(), move, p.Board[indexFromCoords(r, c)])
+			}
+		}
+	}
+
+	if piece == 'p' || piece == 'P' {
+		switch {
+		case sc == dc && target != '_':
+			t.Fatalf("%s: pawn takes straight ahead with %s", p.FEN(), move)
+		case sc != dc && target == '_' && indexName(dst) != p.EnPassant:
+			t.Fatalf("%s: pawn goes diagonally to an empty square with %s", p.FEN(), move)
+		}
+	}
+}
+
+// step is -1, 0 or 1, the direction to go to cover n
+func step(n int) int {
+	switch {
+	case n < 0:
+		return -1
+	case n > 0:
+		return 1
+	}
+	return 0
+}
+
+func FuzzMove(f *testing.F) {
+	f.Add(int64(1), uint8(0), uint8(52), uint8(36), uint8(0))
+	f.Add(int64(2), uint8(20), uint8(50), uint8(19), uint8(7))
+	f.Add(int64(3), uint8(33), uint8(60), uint8(62), uint8(3))
+	f.Add(int64(4), uint8(61), uint8(8), uint8(0), uint8(200))
+
+	// squares are board indexes (mod 64), which finds more moves than
+	// guessing at strings; FuzzPosition covers the parsing
+	f.Fuzz(func(t *testing.T, seed int64, plies, from, to, pick uint8) {
+		p := fuzzPosition(seed, plies)
+		moves := p.Moves()
+		src, dst := indexName(int(from)%64), indexName(int(to)%64)
+
+		// whatever Move accepts has to be in the move list
+		if next, err := p.Move(src, dst); err == nil {
+			move := src + "-" + dst
+
+			found := false
+			for _, m := range moves {
+				found = found || m == move
+			}
+			if !found {
+				t.Fatalf("%s: Move allows %s, which isn't in %v", p.FEN(), move, moves)
+			}
+
+			if next.Board.InCheck(p.WhiteToMove) {
+				t.Fatalf("%s: %s leaves the king in check", p.FEN(), move)
+			}
+		}
+
+		for _, move := range moves {
+			checkRules(t, p, move)
+		}
+
+		if len(moves) == 0 {
+			return
+		}
+
+		// and everything in the move list has to play, write out as SAN,
+		// read back in, and be found again from the boards alone
+		move := moves[int(pick)%len(moves)]
+		next, err := p.Play(move)
+		if err != nil {
+			t.Fatalf("%s: %s is in the move list but won't play: %s", p.FEN(), move, err)
+		}
+
+		san, err := p.SAN(move)
+		if err != nil {
+			t.Fatalf("%s: no SAN for %s: %s", p.FEN(), move, err)
+		}
+
+		if back, err := p.ParseSAN(san); err != nil || back != move {
+			t.Fatalf("%s: %s is %s, which reads back as %s (%v)", p.FEN(), move, san, back, err)
+		}
+
+		inferred, err := p.InferMove(next.Board)
+		if err != nil {
+			t.Fatalf("%s: can't infer %s: %s", p.FEN(), move, err)
+		}
+
+		if again, _ := p.Play(inferred); again.Board != next.Board {
+			t.Fatalf("%s: %s inferred as %s, which makes a different board", p.FEN(), move, inferred)
+		}
+	})
+}
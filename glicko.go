@@ -0,0 +1,130 @@
+package chess
+
+import "math"
+
+// Glicko-2 ratings, from Glickman's "Example of the Glicko-2 system". A
+// rating comes with a deviation (how sure we are of it) and a volatility
+// (how erratic the player is); new players start at 1500 with a big
+// deviation, which shrinks as they play.
+
+// Glicko-2 constants: the starting rating, deviation and volatility, TAU
+// (how fast volatility can change) and the deviation above which a rating
+// is provisional
+const (
+	GLICKO_RATING      = 1500
+	GLICKO_DEVIATION   = 350
+	GLICKO_VOLATILITY  = 0.06
+	GLICKO_TAU         = 0.5
+	GLICKO_PROVISIONAL = 110
+
+	glickoScale   = 173.7178
+	glickoEpsilon = 0.000001
+)
+
+// A Rating is a player's Glicko-2 rating
+type Rating struct {
+	Rating     float64
+	Deviation  float64
+	Volatility float64
+}
+
+// A RatedResult is one game for rating purposes: who it was against and
+// the score (1 for a win, 0.5 for a draw, 0 for a loss)
+type RatedResult struct {
+	Opponent Rating
+	Score    float64
+}
+
+// NewRating is the rating a new player starts with
+func NewRating() Rating {
+	return Rating{
+		Rating:     GLICKO_RATING,
+		Deviation:  GLICKO_DEVIATION,
+		Volatility: GLICKO_VOLATILITY,
+	}
+}
+
+// Provisional is true until there have been enough games to be fairly sure
+// of a rating
+func (r Rating) Provisional() bool {
+	return r.Deviation > GLICKO_PROVISIONAL
+}
+
+func glickoG(phi float64) float64 {
+	return 1 / math.Sqrt(1+3*phi*phi/(math.Pi*math.Pi))
+}
+
+func glickoE(mu, muj, phij float64) float64 {
+	return 1 / (1 + math.Exp(-glickoG(phij)*(mu-muj)))
+}
+
+// Update returns the rating after one rating period with the given
+// results; with no results, only the deviation grows
+func (r Rating) Update(results []RatedResult) Rating {
+	mu := (r.Rating - GLICKO_RATING) / glickoScale
+	phi := r.Deviation / glickoScale
+	sigma := r.Volatility
+
+	if len(results) == 0 {
+		phi = math.Sqrt(phi*phi + sigma*sigma)
+		r.Deviation = math.Min(phi*glickoScale, GLICKO_DEVIATION)
+		return r
+	}
+
+	// step 3 and 4: the estimated variance, and improvement
+	vinv, sum := 0.0, 0.0
+	for _, res := range results {
+		muj := (res.Opponent.Rating - GLICKO_RATING) / glickoScale
+		phij := res.Opponent.Deviation / glickoScale
+
+		g, e := glickoG(phij), glickoE(mu, muj, phij)
+		vinv += g * g * e * (1 - e)
+		sum += g * (res.Score - e)
+	}
+	v := 1 / vinv
+	delta := v * sum
+
+	// step 5: the new volatility, by the Illinois algorithm
+	a := math.Log(sigma * sigma)
+	f := func(x float64) float64 {
+		ex := math.Exp(x)
+		d := phi*phi + v + ex
+		return ex*(delta*delta-d)/(2*d*d) - (x-a)/(GLICKO_TAU*GLICKO_TAU)
+	}
+
+	A := a
+	var B float64
+	if delta*delta > phi*phi+v {
+		B = math.Log(delta*delta - phi*phi - v)
+	} else {
+		k := 1.0
+		for f(a-k*GLICKO_TAU) < 0 {
+			k++
+		}
+		B = a - k*GLICKO_TAU
+	}
+
+	fA, fB := f(A), f(B)
+	for math.Abs(B-A) > glickoEpsilon {
+		C := A + (A-B)*fA/(fB-fA)
+		fC := f(C)
+		if fC*fB <= 0 {
+			A, fA = B, fB
+		} else {
+			fA /= 2
+		}
+		B, fB = C, fC
+	}
+	sigma = math.Exp(A / 2)
+
+	// steps 6 to 8: the new deviation and rating
+	phiStar := math.Sqrt(phi*phi + sigma*sigma)
+	phi = 1 / math.Sqrt(1/(phiStar*phiStar)+1/v)
+	mu += phi * phi * sum
+
+	return Rating{
+		Rating:     mu*glickoScale + GLICKO_RATING,
+		Deviation:  phi * glickoScale,
+		Volatility: sigma,
+	}
+}
@@ -0,0 +1,56 @@
+package chess
+
+import (
+	"math"
+	"testing"
+)
+
+// TestGlickmanExample is the worked example from Glickman's "Example of the
+// Glicko-2 system": a 1500 player beats a 1400 and loses to a 1550 and a
+// 1700 in one rating period
+func TestGlickmanExample(t *testing.T) {
+	r := Rating{Rating: 1500, Deviation: 200, Volatility: 0.06}
+
+	got := r.Update([]RatedResult{
+		{Opponent: Rating{Rating: 1400, Deviation: 30, Volatility: 0.06}, Score: 1},
+		{Opponent: Rating{Rating: 1550, Deviation: 100, Volatility: 0.06}, Score: 0},
+		{Opponent: Rating{Rating: 1700, Deviation: 300, Volatility: 0.06}, Score: 0},
+	})
+
+	if math.Abs(got.Rating-1464.05) > 0.01 || math.Abs(got.Deviation-151.52) > 0.01 || math.Abs(got.Volatility-0.05999) > 0.00001 {
+		t.Errorf("got %.2f / %.2f / %.5f, not 1464.05 / 151.52 / 0.05999", got.Rating, got.Deviation, got.Volatility)
+	}
+}
+
+func TestGlickoIdle(t *testing.T) {
+	r := Rating{Rating: 1700, Deviation: 50, Volatility: 0.06}
+
+	// a period without games only makes the rating less certain
+	idle := r.Update(nil)
+	if idle.Rating != 1700 || idle.Deviation <= 50 || idle.Volatility != 0.06 {
+		t.Errorf("after an idle period: %+v", idle)
+	}
+
+	// but never less certain than a new player's
+	if NewRating().Update(nil).Deviation != GLICKO_DEVIATION {
+		t.Error("a new player's deviation grew")
+	}
+	if !NewRating().Provisional() || r.Provisional() {
+		t.Error("provisional is wrong")
+	}
+}
+
+func TestGlickoSymmetric(t *testing.T) {
+	a, b := NewRating(), NewRating()
+
+	a2 := a.Update([]RatedResult{{Opponent: b, Score: 1}})
+	b2 := b.Update([]RatedResult{{Opponent: a, Score: 0}})
+	if a2.Rating <= 1500 || math.Abs((a2.Rating-1500)-(1500-b2.Rating)) > 0.001 {
+		t.Errorf("winner %.2f, loser %.2f", a2.Rating, b2.Rating)
+	}
+
+	drawn := a.Update([]RatedResult{{Opponent: b, Score: 0.5}})
+	if math.Abs(drawn.Rating-1500) > 0.001 || drawn.Deviation >= a.Deviation {
+		t.Errorf("a draw between equals gave %+v", drawn)
+	}
+}
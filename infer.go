@@ -0,0 +1,55 @@
+package chess
+
+// InferMove figures out which move (in the form Moves uses) turned the
+// position into after, or returns an error if no legal move does.
+func (p Position) InferMove(after Board) (string, error) {
+	after = after.Normalize()
+
+	for _, move := range p.Moves() {
+		next, err := p.Play(move)
+		if err == nil && next.Board == after {
+			return move, nil
+		}
+	}
+
+	return "", illegal("", ILLEGAL_NO_MATCH, "no legal move gets from one board to the other")
+}
+
+// InferMove figures out which move turned before into after when all you
+// have is the two boards, returning the move (in the form Position.Moves
+// uses) and whether it was white's. Castling is assumed to be allowed if the
+// king and rook haven't left their squares, and en passant if it would
+// explain the change.
+func InferMove(before, after Board) (string, bool, error) {
+	before = before.Normalize()
+	after = after.Normalize()
+
+	for _, white := range []bool{true, false} {
+		p := PositionFromBoard(before, white)
+
+		if move, err := p.InferMove(after); err == nil {
+			return move, white, nil
+		}
+
+		// a pawn that turned up on the sixth (or third) rank might have
+		// taken en passant
+		row := 6
+		if !white {
+			row = 3
+		}
+
+		for col := 0; col < 8; col++ {
+			sq := indexFromCoords(row, col)
+			if before[sq] != '_' || after[sq] != pieceOf('P', white) {
+				continue
+			}
+
+			p.EnPassant = indexName(sq)
+			if move, err := p.InferMove(after); err == nil {
+				return move, white, nil
+			}
+		}
+	}
+
+	return "", false, illegal("", ILLEGAL_NO_MATCH, "no legal move gets from one board to the other")
+}
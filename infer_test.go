@@ -0,0 +1,53 @@
+package chess
+
+import "testing"
+
+func TestInferMove(t *testing.T) {
+	for _, test := range []struct {
+		before, move string
+		white        bool
+	}{
+		{"rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1", "E2-E4", true},
+		{"rnbqkbnr/pppppppp/8/8/4P3/8/PPPP1PPP/RNBQKBNR b KQkq - 0 1", "G8-F6", false},
+		{"r3k2r/8/8/8/8/8/8/R3K2R w KQkq - 0 1", "E1-G1", true},
+		{"r3k2r/8/8/8/8/8/8/R3K2R b KQkq - 0 1", "E8-C8", false},
+		{"4k3/8/8/3pP3/8/8/8/4K3 w - d6 0 1", "E5-D6", true},
+		{"4k3/8/8/8/3Pp3/8/8/4K3 b - d3 0 1", "E4-D3", false},
+		{"8/4P3/8/8/8/8/8/k3K3 w - - 0 1", "E7-E8=N", true},
+		{"8/4P3/8/8/8/8/8/k3K3 w - - 0 1", "E7-E8", true},
+	} {
+		p, err := ParseFEN(test.before)
+		if err != nil {
+			t.Fatal(err)
+		}
+		next, err := p.Play(test.move)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if move, err := p.InferMove(next.Board); err != nil || move != test.move {
+			t.Errorf("%s: Position.InferMove got %q (%v), not %s", test.before, move, err, test.move)
+		}
+
+		// from the boards alone, with no side to move or en passant square
+		move, white, err := InferMove(p.Board, next.Board)
+		if err != nil || move != test.move || white != test.white {
+			t.Errorf("%s: InferMove got %q, white %v (%v), not %s", test.before, move, white, err, test.move)
+		}
+	}
+
+	start := StartingPosition(VARIANT_STANDARD).Board
+	for _, after := range []string{
+		// nothing moved
+		"rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1",
+		// two moves
+		"rnbqkbnr/pppppppp/8/8/3PP3/8/PPP2PPP/RNBQKBNR b KQkq - 0 1",
+		// not a legal move
+		"rnbqkbnr/pppppppp/8/8/8/4Q3/PPPPPPPP/RNB1KBNR b KQkq - 0 1",
+	} {
+		p, _ := ParseFEN(after)
+		if move, _, err := InferMove(start, p.Board); err == nil {
+			t.Errorf("%s: inferred %s", after, move)
+		}
+	}
+}
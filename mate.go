@@ -0,0 +1,86 @@
+package chess
+
+import "time"
+
+// A mate-in-N solver. It's a plain exhaustive search: the attacker only
+// tries moves that give check, and every reply is tried for the defender,
+// so it's only practical for small N.
+
+// MateIn looks for a forced mate in at most n moves for the side to move.
+// If there is one, it returns the shortest mating line, attacker's and
+// defender's moves alternating in the form Moves uses, with the defender
+// always choosing the reply that holds out longest. If there isn't, it
+// returns nil and false, which proves there's no mate in n by checks alone.
+func (p Position) MateIn(n int) ([]string, bool) {
+	line, ok, _ := p.mateIn(n, &searcher{})
+	return line, ok
+}
+
+// MateWithin is MateIn, giving up when limit runs out. The last result is
+// false if it gave up, in which case there may still be a mate in n.
+func (p Position) MateWithin(n int, limit time.Duration) ([]string, bool, bool) {
+	return p.mateIn(n, &searcher{deadline: time.Now().Add(limit)})
+}
+
+func (p Position) mateIn(n int, s *searcher) ([]string, bool, bool) {
+	for k := 1; k <= n; k++ {
+		line := s.mate(p, k)
+		if s.stopped {
+			return nil, false, false
+		}
+		if line != nil {
+			return line, true, true
+		}
+	}
+	return nil, false, true
+}
+
+// mate returns a mating line of at most n attacker moves, or nil; a zero
+// deadline never runs out
+func (s *searcher) mate(p Position, n int) []string {
+	for _, move := range p.Moves() {
+		if !s.deadline.IsZero() && s.timeUp() {
+			return nil
+		}
+
+		next, err := p.Play(move)
+		if err != nil || !next.Board.InCheck(next.WhiteToMove) {
+			continue
+		}
+
+		replies := next.Moves()
+		if len(replies) == 0 {
+			return []string{move}
+		}
+
+		if n == 1 {
+			continue
+		}
+
+		// every reply has to lose; the line follows whichever lasts longest
+		var longest []string
+		for _, reply := range replies {
+			after, _ := next.Play(reply)
+
+			var rest []string
+			for k := 1; k < n && rest == nil && !s.stopped; k++ {
+				rest = s.mate(after, k)
+			}
+
+			if rest == nil {
+				longest = nil
+				break
+			}
+
+			if longest == nil || len(rest)+1 > len(longest) {
+				longest = append([]string{reply}, rest...)
+			}
+		}
+
+		if longest != nil {
+			return append([]string{move}, longest...)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,52 @@
+package chess
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMateIn(t *testing.T) {
+	for _, test := range []struct {
+		fen  string
+		n    int
+		want string
+	}{
+		// back rank
+		{"6k1/5ppp/8/8/8/8/8/R5K1 w - - 0 1", 3, "A1-A8"},
+		{"r5k1/8/8/8/8/8/5PPP/6K1 b - - 0 1", 1, "A8-A1"},
+		// the rook that takes on e8 is the only defender
+		{"1r4k1/5ppp/8/8/8/8/4R3/4R1K1 w - - 0 1", 2, "E2-E8 B8-E8 E1-E8"},
+		{"1r4k1/5ppp/8/8/8/8/4R3/4R1K1 w - - 0 1", 1, ""},
+		{"rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1", 2, ""},
+		// stalemate isn't mate
+		{"7k/8/6QK/8/8/8/8/8 w - - 0 1", 1, "G6-G7"},
+		{"k7/8/1QK5/8/8/8/8/8 b - - 0 1", 1, ""},
+	} {
+		p, err := ParseFEN(test.fen)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		line, ok := p.MateIn(test.n)
+		if got := strings.Join(line, " "); got != test.want || ok != (test.want != "") {
+			t.Errorf("%s, mate in %d: got %q (%v), want %q", test.fen, test.n, got, ok, test.want)
+		}
+	}
+}
+
+func TestMateWithin(t *testing.T) {
+	p, err := ParseFEN("8/8/8/3k4/8/8/8/QR2K3 w - - 0 1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok, finished := p.MateWithin(4, time.Nanosecond); ok || finished {
+		t.Errorf("finished a mate in 4 in a nanosecond")
+	}
+
+	p, _ = ParseFEN("6k1/5ppp/8/8/8/8/8/R5K1 w - - 0 1")
+	if line, ok, finished := p.MateWithin(2, time.Minute); !ok || !finished || len(line) != 1 {
+		t.Errorf("back rank mate: %v %v %v", line, ok, finished)
+	}
+}
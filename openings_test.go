@@ -0,0 +1,26 @@
+package chess
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestFindOpening(t *testing.T) {
+	for moves, want := range map[string]string{
+		"":                                     "A00 Uncommon Opening",
+		"a3 e5":                                "A00 Uncommon Opening",
+		"e4":                                   "B00 King's Pawn Game",
+		"e4 c5 Nf3 d6 d4 cxd4 Nxd4 Nf6 Nc3 a6": "B90 Sicilian Defense: Najdorf Variation",
+		// the longest line wins, and the game can go on past it
+		"e4 e5 Nf3 Nc6 Bb5 a6 Ba4 Nf6 O-O Be7": "C70 Ruy Lopez: Morphy Defense",
+		"e4 e5 Nf3 Nc6 Bb5 a6 Bxc6+":           "C68 Ruy Lopez: Exchange Variation",
+		// checks and annotations don't matter
+		"d4 d5 c4! dxc4?": "D20 Queen's Gambit Accepted",
+		// transpositions aren't followed
+		"Nf3 d5 d4": "A04 Reti Opening",
+	} {
+		if got := FindOpening(strings.Fields(moves)).String(); got != want {
+			t.Errorf("%q is %s, not %s", moves, got, want)
+		}
+	}
+}
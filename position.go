@@ -0,0 +1,408 @@
+package chess
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Variants we know how to play
+const (
+	VARIANT_STANDARD = iota
+	VARIANT_CRAZYHOUSE
+)
+
+// A Position is a Board plus everything about a game you can't see by
+// looking at the board: whose move it is, who can still castle, where a
+// pawn can be taken en passant, and (in crazyhouse) what's in each pocket.
+type Position struct {
+	Board Board
+
+	// WhiteToMove is true when it's white's move
+	WhiteToMove bool
+
+	// Castling is the FEN castling field ("KQkq"), empty if nobody can castle
+	Castling string
+
+	// EnPassant is the square a pawn can be taken on en passant ("E3"), or ""
+	EnPassant string
+
+	// HalfMoves counts moves since the last capture or pawn move (the 50
+	// move rule clock); FullMoves starts at 1 and counts after black moves
+	HalfMoves int
+	FullMoves int
+
+	Variant int
+
+	// WhitePocket and BlackPocket are the pieces each side can drop in
+	// crazyhouse, in Board notation (lowercase white, uppercase black)
+	WhitePocket string
+	BlackPocket string
+
+	// Promoted has bit i set when the piece at board index i was promoted
+	// from a pawn; crazyhouse pockets those as pawns when they're captured
+	Promoted uint64
+}
+
+// StartingPosition returns the initial position for a variant
+func StartingPosition(variant int) Position {
+	return Position{
+		Board:       StartingBoard.Normalize(),
+		WhiteToMove: true,
+		Castling:    "KQkq",
+		FullMoves:   1,
+		Variant:     variant,
+	}
+}
+
+// PositionFromBoard makes a Position out of a bare Board, guessing that
+// castling is allowed wherever the king and rook are still on their starting
+// squares. There's no en passant and the move counters start over.
+func PositionFromBoard(board Board, whiteToMove bool) Position {
+	board = board.Normalize()
+	p := Position{
+		Board:       board,
+		WhiteToMove: whiteToMove,
+		FullMoves:   1,
+	}
+
+	for _, c := range []struct {
+		right       string
+		king, rook  int
+		kpiece, rpc byte
+	}{
+		{"K", 60, 63, 'k', 'r'},
+		{"Q", 60, 56, 'k', 'r'},
+		{"k", 4, 7, 'K', 'R'},
+		{"q", 4, 0, 'K', 'R'},
+	} {
+		if board[c.king] == c.kpiece && board[c.rook] == c.rpc {
+			p.Castling += c.right
+		}
+	}
+
+	return p
+}
+
+// Validate checks that a position could come up in a game: one king each,
+// no pawns on the first or last rank, and the side that just moved not left
+// in check
+func (p Position) Validate() error {
+	if len(p.Board) != 64 {
+		return fmt.Errorf("board has %d squares, not 64", len(p.Board))
+	}
+
+	for _, white := range []bool{true, false} {
+		if n := strings.Count(string(p.Board), string(pieceOf('K', white))); n != 1 {
+			return fmt.Errorf("%s has %d kings", colorName(white), n)
+		}
+	}
+
+	for i := 0; i < 64; i++ {
+		if (p.Board[i] == 'p' || p.Board[i] == 'P') && (i < 8 || i >= 56) {
+			return fmt.Errorf("pawn on %s", indexName(i))
+		}
+	}
+
+	if p.Board.InCheck(!p.WhiteToMove) {
+		return fmt.Errorf("%s is in check but it's %s's move", colorName(!p.WhiteToMove), colorName(p.WhiteToMove))
+	}
+
+	return nil
+}
+
+func isWhite(piece byte) bool {
+	return piece >= 'a' && piece <= 'z'
+}
+
+func isBlack(piece byte) bool {
+	return piece >= 'A' && piece <= 'Z'
+}
+
+// ours reports whether the piece belongs to the side to move
+func (p Position) ours(piece byte) bool {
+	if p.WhiteToMove {
+		return isWhite(piece)
+	}
+	return isBlack(piece)
+}
+
+func indexName(i int) string {
+	r, c := coordsFromIndex(i)
+	return fmt.Sprintf("%c%d", 'A'+c, r)
+}
+
+// checkMove makes sure the piece at src can get to dst, following the rules
+// validMoves doesn't know about: castling and en passant.
+func (p Position) checkMove(src, dst int) error {
+	board := p.Board
+	piece := board[src]
+	move := indexName(src) + "-" + indexName(dst)
+
+	if piece == '_' {
+		return illegal(move, ILLEGAL_NO_PIECE, "no piece at %s", indexName(src))
+	}
+
+	if !p.ours(piece) {
+		return illegal(move, ILLEGAL_WRONG_SIDE, "it's not %s's move", colorName(isWhite(piece)))
+	}
+
+	switch {
+	case piece == 'k' && src == 60 && (dst == 62 || dst == 58):
+		return p.checkCastle(src, dst, "K", "Q", 'r')
+
+	case piece == 'K' && src == 4 && (dst == 6 || dst == 2):
+		return p.checkCastle(src, dst, "k", "q", 'R')
+
+	case (piece == 'p' || piece == 'P') && src%8 != dst%8 && board[dst] == '_':
+		if p.EnPassant == "" || indexName(dst) != p.EnPassant {
+			return illegal(move, ILLEGAL_CANT_MOVE_THERE, "can't take en passant on %s", indexName(dst))
+		}
+
+		// one step diagonally forward, from next to the pawn being taken
+		sr, sc := coordsFromIndex(src)
+		dr, dc := coordsFromIndex(dst)
+		from, forward, victim := 5, 1, byte('P')
+		if piece == 'P' {
+			from, forward, victim = 4, -1, 'p'
+		}
+
+		if sr != from || dr != sr+forward || (dc != sc-1 && dc != sc+1) || board[indexFromCoords(sr, dc)] != victim {
+			return illegal(move, ILLEGAL_CANT_MOVE_THERE, "%c at %s can't take en passant on %s", piece, indexName(src), indexName(dst))
+		}
+		return nil
+	}
+
+	for _, mv := range board.validMoves(src) {
+		if indexFromCoords(mv.row, mv.col) == dst {
+			return nil
+		}
+	}
+
+	return illegal(move, ILLEGAL_CANT_MOVE_THERE, "%c at %s can't move to %s", piece, indexName(src), indexName(dst))
+}
+
+// checkCastle checks castling rights and that the squares between the king
+// and rook are empty; kside and qside are the FEN rights for this color
+func (p Position) checkCastle(king, dst int, kside, qside string, rook byte) error {
+	move := indexName(king) + "-" + indexName(dst)
+	right, corner := kside, king+3
+	if dst < king {
+		right, corner = qside, king-4
+	}
+
+	if !strings.Contains(p.Castling, right) {
+		return illegal(move, ILLEGAL_CASTLING, "can't castle that way any more")
+	}
+
+	if p.Board[corner] != rook {
+		return illegal(move, ILLEGAL_CASTLING, "no rook to castle with")
+	}
+
+	lo, hi := king, corner
+	if lo > hi {
+		lo, hi = hi, lo
+	}
+	for i := lo + 1; i < hi; i++ {
+		if p.Board[i] != '_' {
+			return illegal(move, ILLEGAL_CASTLING, "can't castle through pieces")
+		}
+	}
+
+	for _, i := range []int{king, (king + dst) / 2, dst} {
+		if len(p.Board.attackers(i, !p.WhiteToMove)) > 0 {
+			return illegal(move, ILLEGAL_CASTLING, "can't castle out of or through check")
+		}
+	}
+
+	return nil
+}
+
+func colorName(white bool) string {
+	if white {
+		return "white"
+	}
+	return "black"
+}
+
+// Move makes a move in A8, H1 style coordinates, returning the new position
+// or an error if the move isn't allowed. Pawns promote to queens.
+func (p Position) Move(starts, stops string) (Position, error) {
+	return p.Promote(starts, stops, 'Q')
+}
+
+// Promote is Move, but a pawn reaching the last rank becomes promote ('Q',
+// 'R', 'B' or 'N') instead of a queen
+func (p Position) Promote(starts, stops string, promote byte) (Position, error) {
+	if !strings.ContainsRune("QRBN", rune(promote)) {
+		return p, fmt.Errorf("can't promote to %c", promote)
+	}
+
+	starts = strings.ToUpper(starts)
+	stops = strings.ToUpper(stops)
+
+	src, err := p.Board.Position(starts)
+	if err != nil {
+		return p, err
+	}
+
+	dst, err := p.Board.Position(stops)
+	if err != nil {
+		return p, err
+	}
+
+	if err := p.checkMove(src, dst); err != nil {
+		return p, err
+	}
+
+	board := p.Board
+	piece := board[src]
+	captured := board[dst]
+	capturedAt := dst
+
+	if (piece == 'p' || piece == 'P') && captured == '_' && src%8 != dst%8 {
+		// en passant; the pawn we take is next to us, not where we land
+		capturedAt = src - src%8 + dst%8
+		captured = board[capturedAt]
+		board = board.Replace('_', capturedAt)
+	}
+
+	if board, err = board.Move(starts, stops); err != nil {
+		return p, err
+	}
+
+	if (piece == 'p' || piece == 'P') && (dst < 8 || dst >= 56) {
+		board = board.Replace(rune(pieceOf(promote, isWhite(piece))), dst)
+	}
+
+	if board.InCheck(p.WhiteToMove) {
+		return p, illegal(starts+"-"+stops, ILLEGAL_LEAVES_CHECK, "that leaves %s's king in check", colorName(p.WhiteToMove))
+	}
+
+	next := p
+	next.Board = board
+	next.EnPassant = ""
+	next.HalfMoves++
+
+	if captured != '_' {
+		next.HalfMoves = 0
+		if p.Variant == VARIANT_CRAZYHOUSE {
+			next = next.pocket(captured, p.Promoted&(1<<uint(capturedAt)) != 0)
+		}
+	}
+
+	promoted := next.Promoted&(1<<uint(src)) != 0
+	next.Promoted &^= (1 << uint(src)) | (1 << uint(capturedAt))
+
+	if piece == 'p' || piece == 'P' {
+		next.HalfMoves = 0
+
+		if dst < 8 || dst >= 56 {
+			promoted = true
+		}
+
+		if src-dst == 16 || dst-src == 16 {
+			next.EnPassant = indexName((src + dst) / 2)
+		}
+	}
+
+	if promoted {
+		next.Promoted |= 1 << uint(dst)
+	}
+
+	for _, sq := range []int{src, dst} {
+		switch sq {
+		case 60:
+			next.Castling = strings.NewReplacer("K", "", "Q", "").Replace(next.Castling)
+		case 63:
+			next.Castling = strings.Replace(next.Castling, "K", "", -1)
+		case 56:
+			next.Castling = strings.Replace(next.Castling, "Q", "", -1)
+		case 4:
+			next.Castling = strings.NewReplacer("k", "", "q", "").Replace(next.Castling)
+		case 7:
+			next.Castling = strings.Replace(next.Castling, "k", "", -1)
+		case 0:
+			next.Castling = strings.Replace(next.Castling, "q", "", -1)
+		}
+	}
+
+	if !p.WhiteToMove {
+		next.FullMoves++
+	}
+	next.WhiteToMove = !p.WhiteToMove
+
+	return next, nil
+}
+
+// splitMove pulls apart a move written the way Moves writes it
+func (p Position) splitMove(move string) (src, dst int, promote byte, err error) {
+	promote = 'Q'
+	if i := strings.Index(move, "="); i != -1 && i == len(move)-2 {
+		promote = strings.ToUpper(move)[i+1]
+		move = move[:i]
+	}
+
+	squares := strings.Split(move, "-")
+	if len(squares) != 2 || len(squares[0]) != 2 || len(squares[1]) != 2 {
+		return 0, 0, promote, &NotationError{move}
+	}
+
+	if src, err = p.Board.Position(squares[0]); err != nil {
+		return
+	}
+	dst, err = p.Board.Position(squares[1])
+	return
+}
+
+// Play makes a move given the way Moves writes it: "E2-E4", "E7-E8=N" for
+// promotions other than to a queen, or "N@f3"
+func (p Position) Play(move string) (Position, error) {
+	if DropRx.MatchString(move) {
+		return p.Drop(move)
+	}
+
+	src, dst, promote, err := p.splitMove(move)
+	if err != nil {
+		return p, err
+	}
+
+	return p.Promote(indexName(src), indexName(dst), promote)
+}
+
+// Moves returns every move the side to move can make, as "E2-E4" style
+// coordinate pairs (with "E7-E8=R" and so on for underpromotions), plus
+// "N@f3" style drops in crazyhouse.
+func (p Position) Moves() (ret []string) {
+	for src := 0; src < 64; src++ {
+		if !p.ours(p.Board[src]) {
+			continue
+		}
+
+		dsts := []int{}
+		for _, mv := range p.Board.validMoves(src) {
+			dsts = append(dsts, indexFromCoords(mv.row, mv.col))
+		}
+
+		if p.Board[src] == 'k' || p.Board[src] == 'K' {
+			dsts = append(dsts, src+2, src-2)
+		}
+
+		for _, dst := range dsts {
+			if dst < 0 || dst >= 64 {
+				continue
+			}
+
+			if _, err := p.Move(indexName(src), indexName(dst)); err == nil {
+				ret = append(ret, indexName(src)+"-"+indexName(dst))
+
+				if (p.Board[src] == 'p' || p.Board[src] == 'P') && (dst < 8 || dst >= 56) {
+					for _, under := range []string{"R", "B", "N"} {
+						ret = append(ret, indexName(src)+"-"+indexName(dst)+"="+under)
+					}
+				}
+			}
+		}
+	}
+
+	return append(ret, p.Drops()...)
+}
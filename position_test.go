@@ -0,0 +1,75 @@
+package chess
+
+import "testing"
+
+func perft(t *testing.T, p Position, depth int) int {
+	if depth == 0 {
+		return 1
+	}
+
+	n := 0
+	for _, move := range p.Moves() {
+		next, err := p.Play(move)
+		if err != nil {
+			t.Fatalf("%s: Moves gave %s, which won't play: %s", p.FEN(), move, err)
+		}
+		n += perft(t, next, depth-1)
+	}
+	return n
+}
+
+// The standard perft positions, from the Chess Programming Wiki
+var perftTests = []struct {
+	name  string
+	fen   string
+	nodes []int
+}{
+	{"start", "rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1", []int{20, 400, 8902}},
+	{"kiwipete", "r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w KQkq - 0 1", []int{48, 2039}},
+	{"position 3", "8/2p5/3p4/KP5r/1R3p1k/8/4P1P1/8 w - - 0 1", []int{14, 191, 2812}},
+	{"position 4", "r3k2r/Pppp1ppp/1b3nbN/nP6/BBP1P3/q4N2/Pp1P2PP/R2Q1RK1 w kq - 0 1", []int{6, 264, 9467}},
+	{"position 5", "rnbq1k1r/pp1Pbppp/2p5/8/2B5/8/PPP1NnPP/RNBQK2R w KQ - 1 8", []int{44, 1486}},
+	{"position 6", "r4rk1/1pp1qppp/p1np1n2/2b1p1B1/2B1P1b1/P1NP1N2/1PP1QPPP/R4RK1 w - - 0 10", []int{46, 2079}},
+}
+
+func TestPerft(t *testing.T) {
+	for _, test := range perftTests {
+		p, err := ParseFEN(test.fen)
+		if err != nil {
+			t.Fatalf("%s: %s", test.name, err)
+		}
+
+		for depth, want := range test.nodes {
+			if testing.Short() && depth > 1 {
+				break
+			}
+
+			if got := perft(t, p, depth+1); got != want {
+				t.Errorf("%s: perft(%d) = %d, want %d", test.name, depth+1, got, want)
+			}
+		}
+	}
+}
+
+func TestEnPassant(t *testing.T) {
+	p, err := ParseFEN("4k3/8/8/3pP3/8/8/2P5/4K3 w - d6 0 1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, move := range [][2]string{{"C2", "D6"}, {"C2", "D3"}, {"E1", "D6"}} {
+		if _, err := p.Move(move[0], move[1]); err == nil {
+			t.Errorf("%s-%s shouldn't be allowed", move[0], move[1])
+		}
+	}
+
+	next, err := p.Move("E5", "D6")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want, _ := ParseFEN("4k3/8/3P4/8/8/8/2P5/4K3 b - - 0 1")
+	if next.Board != want.Board {
+		t.Errorf("after exd6 e.p.: %s", next.FEN())
+	}
+}
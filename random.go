@@ -0,0 +1,71 @@
+package chess
+
+import (
+	"fmt"
+	"math/rand"
+	"strings"
+)
+
+// Random games and positions, for fuzzing and test positions. Everything
+// takes a seed, so the same seed always gives the same result.
+
+// RandomGame plays up to n random legal moves from the starting position,
+// stopping early at mate or stalemate, and returns the moves (in the form
+// Moves uses) and the final position
+func RandomGame(seed int64, n int) ([]string, Position) {
+	rng := rand.New(rand.NewSource(seed))
+	p := StartingPosition(VARIANT_STANDARD)
+	played := []string{}
+
+	for i := 0; i < n; i++ {
+		moves := p.Moves()
+		if len(moves) == 0 {
+			break
+		}
+
+		move := moves[rng.Intn(len(moves))]
+		p, _ = p.Play(move)
+		played = append(played, move)
+	}
+
+	return played, p
+}
+
+// RandomPosition scatters material (in Board notation, like "kqKr": white
+// king and queen against black king and rook) over the board, retrying
+// until the result passes Validate. Material has to include one king of
+// each color. Nobody can castle.
+func RandomPosition(seed int64, material string, whiteToMove bool) (Position, error) {
+	rng := rand.New(rand.NewSource(seed))
+
+	if len(material) > 64 {
+		return Position{}, fmt.Errorf("too much material for one board")
+	}
+
+	for _, c := range material {
+		if !strings.ContainsRune("pnbrqkPNBRQK", c) {
+			return Position{}, fmt.Errorf("bad piece '%c'", c)
+		}
+	}
+
+	var err error
+	for tries := 0; tries < 1000; tries++ {
+		board := []byte(strings.Repeat("_", 64))
+
+		for i, sq := range rng.Perm(64)[:len(material)] {
+			board[sq] = material[i]
+		}
+
+		p := Position{
+			Board:       Board(board),
+			WhiteToMove: whiteToMove,
+			FullMoves:   1,
+		}
+
+		if err = p.Validate(); err == nil {
+			return p, nil
+		}
+	}
+
+	return Position{}, fmt.Errorf("couldn't place %s legally: %s", material, err)
+}
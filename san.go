@@ -0,0 +1,115 @@
+package chess
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Standard algebraic notation ("Nbd2", "exd5", "O-O", "Qh7#"), converted
+// to and from the "E2-E4" coordinate moves Position uses.
+
+// SAN returns a move, in the form Moves uses, in standard algebraic notation
+func (p Position) SAN(move string) (string, error) {
+	next, err := p.Play(move)
+	if err != nil {
+		return "", err
+	}
+
+	san := move
+	if !DropRx.MatchString(move) {
+		src, dst, promote, _ := p.splitMove(move)
+		san = p.sanMove(src, dst, promote)
+	}
+
+	if next.Board.InCheck(next.WhiteToMove) {
+		if len(next.Moves()) == 0 {
+			san += "#"
+		} else {
+			san += "+"
+		}
+	}
+
+	return san, nil
+}
+
+func (p Position) sanMove(src, dst int, promote byte) string {
+	piece := p.Board[src]
+	if isWhite(piece) {
+		piece -= 32
+	}
+
+	if piece == 'K' && dst-src == 2 {
+		return "O-O"
+	}
+	if piece == 'K' && src-dst == 2 {
+		return "O-O-O"
+	}
+
+	to := strings.ToLower(indexName(dst))
+	capture := p.Board[dst] != '_'
+
+	if piece == 'P' {
+		san := to
+		if src%8 != dst%8 {
+			san = fmt.Sprintf("%cx%s", 'a'+src%8, to)
+		}
+		if dst < 8 || dst >= 56 {
+			san += "=" + string(promote)
+		}
+		return san
+	}
+
+	// disambiguate against the same kind of piece that can also get there
+	sameFile, sameRank, others := false, false, false
+	for _, mv := range p.Moves() {
+		from, to, _, err := p.splitMove(mv)
+		if err != nil || to != dst || from == src || p.Board[from] != p.Board[src] {
+			continue
+		}
+
+		others = true
+		sameFile = sameFile || from%8 == src%8
+		sameRank = sameRank || from/8 == src/8
+	}
+
+	from := ""
+	name := strings.ToLower(indexName(src))
+	switch {
+	case !others:
+	case !sameFile:
+		from = name[:1]
+	case !sameRank:
+		from = name[1:]
+	default:
+		from = name
+	}
+
+	x := ""
+	if capture {
+		x = "x"
+	}
+
+	return fmt.Sprintf("%c%s%s%s", piece, from, x, to)
+}
+
+// stripSAN drops check, mate and annotation marks from a SAN move, and
+// accepts zeroes for castling
+func stripSAN(san string) string {
+	san = strings.TrimRight(san, "+#!?")
+	return strings.Replace(san, "0", "O", -1)
+}
+
+// ParseSAN finds the move, in the form Moves uses, that a SAN move
+// describes; check and annotation marks are optional
+func (p Position) ParseSAN(san string) (string, error) {
+	want := stripSAN(san)
+
+	for _, mv := range p.Moves() {
+		got, err := p.SAN(mv)
+		if err == nil && stripSAN(got) == want {
+			return mv, nil
+		}
+	}
+
+	return "", illegal(san, ILLEGAL_NO_MATCH, "no matching move: %s", san)
+}
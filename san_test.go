@@ -0,0 +1,86 @@
+package chess
+
+import "testing"
+
+func TestSAN(t *testing.T) {
+	for _, test := range []struct {
+		fen, move, san string
+	}{
+		{"rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1", "G1-F3", "Nf3"},
+		{"rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1", "E2-E4", "e4"},
+		{"rnbqkbnr/ppp1pppp/8/3p4/4P3/8/PPPP1PPP/RNBQKBNR w KQkq - 0 2", "E4-D5", "exd5"},
+		{"4k3/8/8/3pP3/8/8/8/4K3 w - d6 0 1", "E5-D6", "exd6"},
+		{"r3k2r/8/8/8/8/8/8/R3K2R w KQkq - 0 1", "E1-G1", "O-O"},
+		{"r3k2r/8/8/8/8/8/8/R3K2R b KQkq - 0 1", "E8-C8", "O-O-O"},
+		// two knights can reach d2: by file, then by rank, then both
+		{"4k3/8/8/8/8/8/8/1N2KN2 w - - 0 1", "B1-D2", "Nbd2"},
+		{"4k3/8/8/N7/8/8/8/N3K3 w - - 0 1", "A1-B3", "N1b3"},
+		{"6k1/8/8/8/Q7/8/7K/Q2Q4 w - - 0 1", "A1-D4", "Qa1d4"},
+		{"6k1/8/8/8/Q7/8/7K/Q2Q4 w - - 0 1", "A4-D4", "Q4d4"},
+		{"8/4P3/8/8/8/8/8/k3K3 w - - 0 1", "E7-E8=N", "e8=N"},
+		// queening is the plain move
+		{"3r4/4P3/8/8/8/8/8/k3K3 w - - 0 1", "E7-D8", "exd8=Q"},
+		{"6k1/5ppp/8/8/8/8/8/R5K1 w - - 0 1", "A1-A8", "Ra8#"},
+	} {
+		p, err := ParseFEN(test.fen)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		san, err := p.SAN(test.move)
+		if err != nil || san != test.san {
+			t.Errorf("%s: %s is %q (%v), not %s", test.fen, test.move, san, err, test.san)
+			continue
+		}
+
+		if move, err := p.ParseSAN(san); err != nil || move != test.move {
+			t.Errorf("%s: %s parsed as %q (%v), not %s", test.fen, san, move, err, test.move)
+		}
+	}
+}
+
+func TestSANRoundTrip(t *testing.T) {
+	for seed := int64(1); seed <= 5; seed++ {
+		p := StartingPosition(VARIANT_STANDARD)
+		moves, _ := RandomGame(seed, 60)
+
+		for _, move := range moves {
+			san, err := p.SAN(move)
+			if err != nil {
+				t.Fatalf("seed %d, %s: %s: %s", seed, p.FEN(), move, err)
+			}
+
+			back, err := p.ParseSAN(san)
+			if err != nil || back != move {
+				t.Fatalf("seed %d, %s: %s is %s, which parses as %q (%v)", seed, p.FEN(), move, san, back, err)
+			}
+
+			p, _ = p.Play(move)
+		}
+	}
+}
+
+func TestParseSAN(t *testing.T) {
+	p := StartingPosition(VARIANT_STANDARD)
+
+	// marks and zeroes are optional
+	for san, want := range map[string]string{
+		"Nf3!?": "G1-F3",
+		"e4+":   "E2-E4",
+	} {
+		if move, err := p.ParseSAN(san); err != nil || move != want {
+			t.Errorf("%s parsed as %q (%v)", san, move, err)
+		}
+	}
+
+	p, _ = ParseFEN("r3k2r/8/8/8/8/8/8/R3K2R w KQkq - 0 1")
+	if move, err := p.ParseSAN("0-0-0"); err != nil || move != "E1-C1" {
+		t.Errorf("0-0-0 parsed as %q (%v)", move, err)
+	}
+
+	for _, san := range []string{"Nf4", "e5", "Ke2", "", "Qxh7#"} {
+		if _, err := StartingPosition(VARIANT_STANDARD).ParseSAN(san); err == nil {
+			t.Errorf("%s shouldn't parse in the starting position", san)
+		}
+	}
+}
@@ -0,0 +1,184 @@
+package chess
+
+import (
+	"sort"
+	"time"
+)
+
+// A small alpha-beta search over Evaluate, so there's something to point
+// test suites at. It's not fast; the move generator builds strings.
+
+// MATE is the score for giving mate; mates further away score a little less
+const MATE = 100000
+
+type searcher struct {
+	deadline time.Time
+	nodes    int
+	stopped  bool
+}
+
+// relativeScore is Evaluate from the side to move's point of view
+func (p Position) relativeScore() int {
+	return sign(p.WhiteToMove) * p.Board.Evaluate().Score()
+}
+
+// target returns the piece a move captures, '_' if none
+func (p Position) target(move string) byte {
+	_, dst, _, err := p.splitMove(move)
+	if err != nil {
+		return '_'
+	}
+	return p.Board[dst]
+}
+
+// orderedMoves returns Moves with captures first, biggest victim and then
+// smallest attacker first
+func (p Position) orderedMoves() []string {
+	moves := p.Moves()
+
+	score := func(move string) int {
+		victim := p.target(move)
+		if victim == '_' {
+			return 0
+		}
+		src, _, _, _ := p.splitMove(move)
+		return 10*pieceValue(victim) - pieceValue(p.Board[src])
+	}
+
+	sort.SliceStable(moves, func(i, j int) bool {
+		return score(moves[i]) > score(moves[j])
+	})
+
+	return moves
+}
+
+// Search searches for the best move for the side to move until limit runs
+// out, deepening one move at a time. It returns the best move from the
+// deepest search that finished, in the form Moves uses, and its score in
+// centipawns for the side to move; the move is "" if there are none.
+func (p Position) Search(limit time.Duration) (string, int) {
+	s := &searcher{
+		deadline: time.Now().Add(limit),
+	}
+
+	moves := p.orderedMoves()
+	if len(moves) == 0 {
+		return "", 0
+	}
+
+	best, score := moves[0], 0
+
+	for depth := 1; depth < 64; depth++ {
+		bestHere, alpha := "", -MATE-1
+		for _, move := range moves {
+			next, _ := p.Play(move)
+			sc := -s.negamax(next, depth-1, -MATE-1, -alpha, 1)
+			if s.stopped {
+				break
+			}
+			if sc > alpha {
+				bestHere, alpha = move, sc
+			}
+		}
+
+		if s.stopped {
+			break
+		}
+
+		best, score = bestHere, alpha
+
+		// search the best move first next time round
+		for i, move := range moves {
+			if move == best {
+				copy(moves[1:i+1], moves[:i])
+				moves[0] = best
+				break
+			}
+		}
+
+		if score > MATE-64 || score < -MATE+64 {
+			break
+		}
+	}
+
+	return best, score
+}
+
+func (s *searcher) timeUp() bool {
+	s.nodes++
+	if s.nodes%256 == 0 && time.Now().After(s.deadline) {
+		s.stopped = true
+	}
+	return s.stopped
+}
+
+func (s *searcher) negamax(p Position, depth, alpha, beta, ply int) int {
+	if s.timeUp() {
+		return 0
+	}
+
+	if depth <= 0 {
+		return s.quiesce(p, alpha, beta, ply)
+	}
+
+	moves := p.orderedMoves()
+	if len(moves) == 0 {
+		if p.Board.InCheck(p.WhiteToMove) {
+			return -MATE + ply
+		}
+		return 0
+	}
+
+	for _, move := range moves {
+		next, _ := p.Play(move)
+		sc := -s.negamax(next, depth-1, -beta, -alpha, ply+1)
+		if s.stopped {
+			return 0
+		}
+		if sc >= beta {
+			return beta
+		}
+		if sc > alpha {
+			alpha = sc
+		}
+	}
+
+	return alpha
+}
+
+// quiesce only searches captures, so the search doesn't stop in the middle
+// of an exchange
+func (s *searcher) quiesce(p Position, alpha, beta, ply int) int {
+	if s.timeUp() {
+		return 0
+	}
+
+	stand := p.relativeScore()
+	if stand >= beta {
+		return beta
+	}
+	if stand > alpha {
+		alpha = stand
+	}
+
+	for _, move := range p.orderedMoves() {
+		if p.target(move) == '_' {
+			// captures come first, so there are no more
+			break
+		}
+
+		next, _ := p.Play(move)
+		sc := -s.quiesce(next, -beta, -alpha, ply+1)
+		if s.stopped {
+			return 0
+		}
+		if sc >= beta {
+			return beta
+		}
+		if sc > alpha {
+			alpha = sc
+		}
+	}
+
+	return alpha
+}
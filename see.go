@@ -0,0 +1,140 @@
+package chess
+
+// Static exchange evaluation: figure out who comes out ahead if both sides
+// keep capturing on one square, always with their cheapest piece. Pins
+// aren't considered, but x-rays are (a rook behind a rook joins in once the
+// one in front has captured).
+
+// Piece values in centipawns, keyed by the black (uppercase) piece letter
+var PieceValues = map[byte]int{
+	'P': 100,
+	'N': 300,
+	'B': 300,
+	'R': 500,
+	'Q': 900,
+	'K': 10000,
+}
+
+func pieceValue(piece byte) int {
+	if isWhite(piece) {
+		piece -= 32
+	}
+	return PieceValues[piece]
+}
+
+// cheapest returns the least valuable of a list of board indexes, or -1
+func (board Board) cheapest(from []int) int {
+	best := -1
+	for _, i := range from {
+		if best == -1 || pieceValue(board[i]) < pieceValue(board[best]) {
+			best = i
+		}
+	}
+	return best
+}
+
+// see plays out the exchange on dst starting with the piece at src taking,
+// and returns the material the side that moves first gains
+func (board Board) see(src, dst int) int {
+	gain := []int{pieceValue(board[dst])}
+	white := isWhite(board[src])
+
+	for {
+		board = board.Replace(rune(board[src]), dst).Replace('_', src)
+		white = !white
+
+		src = board.cheapest(board.attackers(dst, white))
+		if src == -1 {
+			break
+		}
+
+		// what the side about to capture gains if it does, given what
+		// it stands to lose if it stops now
+		gain = append(gain, pieceValue(board[dst])-gain[len(gain)-1])
+	}
+
+	// each side can stop capturing whenever carrying on would lose
+	for d := len(gain) - 1; d > 0; d-- {
+		if -gain[d] < gain[d-1] {
+			gain[d-1] = -gain[d]
+		}
+	}
+
+	return gain[0]
+}
+
+// SEE returns how much material white (or black) wins, in centipawns, by
+// starting an exchange on a square with its cheapest attacker. It's 0 if
+// there's nothing to take or nothing to take it with.
+func (board Board) SEE(square string, white bool) (int, error) {
+	dst, err := board.Position(square)
+	if err != nil {
+		return 0, err
+	}
+
+	if board[dst] == '_' {
+		return 0, nil
+	}
+
+	src := board.cheapest(board.attackers(dst, white))
+	if src == -1 {
+		return 0, nil
+	}
+
+	if g := board.see(src, dst); g > 0 {
+		return g, nil
+	}
+
+	return 0, nil
+}
+
+// SEECapture returns how much material a capture gains (or, if negative,
+// loses) once the exchange it starts has played out, taking A8, H1 style
+// coordinates like Move.
+func (board Board) SEECapture(starts, stops string) (int, error) {
+	src, err := board.Position(starts)
+	if err != nil {
+		return 0, err
+	}
+
+	dst, err := board.Position(stops)
+	if err != nil {
+		return 0, err
+	}
+
+	if board[src] == '_' {
+		return 0, illegal(starts+"-"+stops, ILLEGAL_NO_PIECE, "no piece at %s", starts)
+	}
+
+	return board.see(src, dst), nil
+}
+
+// Undefended returns the squares of white's (or black's) pieces, other than
+// the king, that none of their own pieces defend
+func (board Board) Undefended(white bool) (ret []string) {
+	for i := 0; i < len(board); i++ {
+		if board[i] == '_' || isWhite(board[i]) != white || board[i] == pieceOf('K', white) {
+			continue
+		}
+
+		if len(board.attackers(i, white)) == 0 {
+			ret = append(ret, indexName(i))
+		}
+	}
+	return
+}
+
+// Hanging returns the squares of white's (or black's) pieces that the other
+// side can win material by taking
+func (board Board) Hanging(white bool) (ret []string) {
+	for i := 0; i < len(board); i++ {
+		if board[i] == '_' || isWhite(board[i]) != white || board[i] == pieceOf('K', white) {
+			continue
+		}
+
+		if g, _ := board.SEE(indexName(i), !white); g > 0 {
+			ret = append(ret, indexName(i))
+		}
+	}
+	return
+}
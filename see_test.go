@@ -0,0 +1,60 @@
+package chess
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSEECapture(t *testing.T) {
+	for _, test := range []struct {
+		fen, from, to string
+		want          int
+	}{
+		// the rook takes a pawn nobody defends
+		{"1k1r4/1pp4p/p7/4p3/8/P5P1/1PP4P/2K1R3 w - - 0 1", "E1", "E5", 100},
+		// the knight takes a pawn, and is taken by a knight, with the
+		// queen and rook behind it not enough to win it back
+		{"1k1r3q/1ppn3p/p4b2/4p3/8/P2N2P1/1PP1R1BP/2K1Q3 w - - 0 1", "D3", "E5", -200},
+		// pawn takes a defended knight
+		{"4k3/8/3p4/4n3/3P4/8/8/4K3 w - - 0 1", "D4", "E5", 200},
+		// queen takes a pawn a pawn defends
+		{"4k3/8/3p4/4p3/8/8/7Q/4K3 w - - 0 1", "H2", "E5", -800},
+		// the rooks x-ray: the second one joins in behind the first
+		{"4k3/3r4/8/8/3p4/8/3R4/3RK3 w - - 0 1", "D2", "D4", 100},
+		{"3rk3/3r4/8/8/3p4/8/3R4/3RK3 w - - 0 1", "D2", "D4", -400},
+	} {
+		p, err := ParseFEN(test.fen)
+		if err != nil {
+			t.Fatalf("%s: %s", test.fen, err)
+		}
+
+		if got, err := p.Board.SEECapture(test.from, test.to); err != nil || got != test.want {
+			t.Errorf("%s: %s-%s gains %d (%v), not %d", test.fen, test.from, test.to, got, err, test.want)
+		}
+	}
+}
+
+func TestHanging(t *testing.T) {
+	p, err := ParseFEN("4k3/8/2n5/1B2p3/3P4/8/5q2/4K2R w - - 0 1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// nothing defends the knight or the queen, but the knight defends e5
+	if got, _ := p.Board.SEE("C6", true); got != 300 {
+		t.Errorf("Bxc6 gains %d", got)
+	}
+	if got, _ := p.Board.SEE("E5", true); got != 0 {
+		t.Errorf("dxe5 gains %d", got)
+	}
+
+	if got := p.Board.Hanging(false); !reflect.DeepEqual(got, []string{"C6", "F2"}) {
+		t.Errorf("black's hanging pieces are %v", got)
+	}
+	if got := p.Board.Hanging(true); !reflect.DeepEqual(got, []string{"D4"}) {
+		t.Errorf("white's hanging pieces are %v", got)
+	}
+	if got := p.Board.Undefended(false); !reflect.DeepEqual(got, []string{"C6", "F2"}) {
+		t.Errorf("black's undefended pieces are %v", got)
+	}
+}
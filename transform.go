@@ -0,0 +1,141 @@
+package chess
+
+import "strings"
+
+// Board and position transformations. Flip turns the board upside down
+// (rank 1 swaps with rank 8), Mirror swaps the A and H files, and
+// SwapColors flips the board and changes every piece's color, which gives
+// the same position from the other side's point of view.
+
+// Flip swaps rank 1 with rank 8, rank 2 with rank 7 and so on
+func (board Board) Flip() Board {
+	board = board.Normalize()
+	out := []byte{}
+	for r := 7; r >= 0; r-- {
+		out = append(out, board[r*8:r*8+8]...)
+	}
+	return Board(out)
+}
+
+// Mirror swaps the A file with the H file, B with G and so on
+func (board Board) Mirror() Board {
+	board = board.Normalize()
+	out := []byte(board)
+	for i := range out {
+		out[i] = board[i-i%8+7-i%8]
+	}
+	return Board(out)
+}
+
+// SwapColors flips the board and makes white pieces black and black pieces
+// white
+func (board Board) SwapColors() Board {
+	return Board(strings.Map(swapCase, string(board.Flip())))
+}
+
+// flipIndex and mirrorIndex say where a board index goes
+func flipIndex(i int) int {
+	return 56 - i + 2*(i%8)
+}
+
+func mirrorIndex(i int) int {
+	return i - i%8 + 7 - i%8
+}
+
+func transformBits(bits uint64, f func(int) int) (ret uint64) {
+	for i := 0; i < 64; i++ {
+		if bits&(1<<uint(i)) != 0 {
+			ret |= 1 << uint(f(i))
+		}
+	}
+	return
+}
+
+func transformSquare(sq string, f func(int) int) string {
+	if sq == "" {
+		return ""
+	}
+	i, err := Board("").Position(sq)
+	if err != nil {
+		return ""
+	}
+	return indexName(f(i))
+}
+
+// Flip turns the board upside down. Neither side can castle afterwards (the
+// kings aren't on their own back ranks), and pawns move the wrong way for
+// en passant to make sense, so both are cleared.
+func (p Position) Flip() Position {
+	p.Board = p.Board.Flip()
+	p.Promoted = transformBits(p.Promoted, flipIndex)
+	p.Castling = ""
+	p.EnPassant = ""
+	return p
+}
+
+// Mirror swaps the A and H files. Castling rights are cleared, since the
+// king and rooks are no longer where castling needs them; the en passant
+// square moves to the other side of the board.
+func (p Position) Mirror() Position {
+	p.Board = p.Board.Mirror()
+	p.Promoted = transformBits(p.Promoted, mirrorIndex)
+	p.Castling = ""
+	p.EnPassant = transformSquare(p.EnPassant, mirrorIndex)
+	return p
+}
+
+// SwapColors gives the same position with the colors reversed: the board
+// flipped, every piece the other color, the other side to move, and
+// castling rights, en passant and pockets swapped to match. Evaluating it
+// should give the opposite score.
+func (p Position) SwapColors() Position {
+	p.Board = p.Board.SwapColors()
+	p.Promoted = transformBits(p.Promoted, flipIndex)
+	p.WhiteToMove = !p.WhiteToMove
+	p.EnPassant = transformSquare(p.EnPassant, flipIndex)
+	p.WhitePocket, p.BlackPocket = sortPocket(strings.Map(swapCase, p.BlackPocket)), sortPocket(strings.Map(swapCase, p.WhitePocket))
+
+	// keep castling rights in KQkq order
+	castling := ""
+	for _, c := range "KQkq" {
+		if strings.ContainsRune(p.Castling, swapCase(c)) {
+			castling += string(c)
+		}
+	}
+	p.Castling = castling
+
+	return p
+}
+
+// key is the FEN without the move counters, which is what matters when
+// deciding if two positions are the same
+func (p Position) key() string {
+	fields := strings.Fields(p.FEN())
+	return strings.Join(fields[:4], " ")
+}
+
+// Canonical returns one representative of the positions that are the same
+// as this one up to symmetry: this one and its color swap, plus their
+// mirror images when nobody can castle. Two positions are symmetric
+// versions of each other if their canonical forms have the same FEN (move
+// counters aside).
+func (p Position) Canonical() Position {
+	cands := []Position{p, p.SwapColors()}
+	if p.Castling == "" {
+		cands = append(cands, p.Mirror(), p.SwapColors().Mirror())
+	}
+
+	best := cands[0]
+	for _, c := range cands[1:] {
+		if c.key() < best.key() {
+			best = c
+		}
+	}
+	return best
+}
+
+// SameUpToSymmetry reports whether two positions are the same once colors
+// and (when nobody can castle) sides of the board are allowed to swap
+func (p Position) SameUpToSymmetry(q Position) bool {
+	return p.Canonical().key() == q.Canonical().key()
+}
@@ -0,0 +1,316 @@
+package chess
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// A game tree: the moves of a game plus any side variations, each with
+// optional comments and NAGs (PGN's numbered annotations, like $1 for "!"),
+// written out as PGN with the variations in parentheses.
+
+// A Node is one position in a game tree, and the move that got there
+type Node struct {
+	// Move is the move that led here in SAN (or whatever the caller added
+	// it as); it's "" at the root
+	Move     string
+	Position Position
+
+	Comment string
+	NAGs    []int
+
+	// Parent isn't saved as JSON, since the tree would never end; it's
+	// filled back in when the tree is loaded
+	Parent *Node `json:"-"`
+
+	// Children are the moves played from here; the first is the main line
+	// and the rest are variations
+	Children []*Node
+}
+
+// NewGame starts a game tree at a position
+func NewGame(p Position) *Node {
+	return &Node{
+		Position: p,
+	}
+}
+
+// Play makes a move from this node, in SAN or the form Moves uses, returning
+// the new node; if the move has been played from here before, that node is
+// returned instead of adding it again.
+func (n *Node) Play(move string) (*Node, error) {
+	if _, err := n.Position.Play(move); err != nil {
+		if move, err = n.Position.ParseSAN(move); err != nil {
+			return nil, err
+		}
+	}
+
+	san, _ := n.Position.SAN(move)
+	next, _ := n.Position.Play(move)
+
+	return n.add(san, next), nil
+}
+
+// Add adds a move that produced board without checking it, for callers that
+// don't play by the rules (or don't know them). The move can be written any
+// way; it's used as is in PGN.
+func (n *Node) Add(move string, board Board) *Node {
+	p := PositionFromBoard(board, !n.Position.WhiteToMove)
+	p.Variant = n.Position.Variant
+	p.HalfMoves = n.Position.HalfMoves + 1
+	p.FullMoves = n.Position.FullMoves
+	if !n.Position.WhiteToMove {
+		p.FullMoves++
+	}
+
+	// can't get castling rights back once they're lost
+	castling := ""
+	for _, c := range p.Castling {
+		if strings.ContainsRune(n.Position.Castling, c) {
+			castling += string(c)
+		}
+	}
+	p.Castling = castling
+
+	return n.add(move, p)
+}
+
+func (n *Node) add(move string, p Position) *Node {
+	for _, c := range n.Children {
+		if c.Move == move {
+			return c
+		}
+	}
+
+	c := &Node{
+		Move:     move,
+		Position: p,
+		Parent:   n,
+	}
+	n.Children = append(n.Children, c)
+	return c
+}
+
+// Root returns the start of the game
+func (n *Node) Root() *Node {
+	for n.Parent != nil {
+		n = n.Parent
+	}
+	return n
+}
+
+// Line returns the moves from the start of the game to here
+func (n *Node) Line() (ret []*Node) {
+	for ; n.Parent != nil; n = n.Parent {
+		ret = append([]*Node{n}, ret...)
+	}
+	return
+}
+
+// Mainline returns the main line from the start of the game
+func (n *Node) Mainline() (ret []*Node) {
+	for n = n.Root(); len(n.Children) > 0; n = n.Children[0] {
+		ret = append(ret, n.Children[0])
+	}
+	return
+}
+
+// IsMainline reports whether this node is on the main line
+func (n *Node) IsMainline() bool {
+	for ; n.Parent != nil; n = n.Parent {
+		if n.Parent.Children[0] != n {
+			return false
+		}
+	}
+	return true
+}
+
+// Promote makes the variation this node starts the main line at its
+// branch point, with the old main line becoming a variation
+func (n *Node) Promote() {
+	if n.Parent == nil {
+		return
+	}
+
+	siblings := n.Parent.Children
+	for i, c := range siblings {
+		if c == n {
+			copy(siblings[1:i+1], siblings[:i])
+			siblings[0] = n
+			return
+		}
+	}
+}
+
+// Delete cuts this node, and everything after it, out of the tree
+func (n *Node) Delete() {
+	if n.Parent == nil {
+		return
+	}
+
+	siblings := n.Parent.Children
+	for i, c := range siblings {
+		if c == n {
+			n.Parent.Children = append(siblings[:i:i], siblings[i+1:]...)
+			break
+		}
+	}
+	n.Parent = nil
+}
+
+// UnmarshalJSON loads a tree saved with encoding/json, pointing each node
+// back at its parent
+func (n *Node) UnmarshalJSON(data []byte) error {
+	type node Node
+	if err := json.Unmarshal(data, (*node)(n)); err != nil {
+		return err
+	}
+
+	for _, c := range n.Children {
+		c.Parent = n
+	}
+	return nil
+}
+
+// Path returns which child to take at each step from the root to get
+// here, for finding this node again in a copy of the tree
+func (n *Node) Path() (ret []int) {
+	for ; n.Parent != nil; n = n.Parent {
+		for i, c := range n.Parent.Children {
+			if c == n {
+				ret = append([]int{i}, ret...)
+				break
+			}
+		}
+	}
+	return
+}
+
+// Follow goes down a Path from this node, stopping early if the path
+// leaves the tree
+func (n *Node) Follow(path []int) *Node {
+	for _, i := range path {
+		if i < 0 || i >= len(n.Children) {
+			break
+		}
+		n = n.Children[i]
+	}
+	return n
+}
+
+// The seven tags PGN wants first, in order
+var pgnRoster = []string{"Event", "Site", "Date", "Round", "White", "Black", "Result"}
+
+// PGN writes the whole game, variations and all, as PGN. The Result tag
+// (default "*") also ends the move text.
+func (n *Node) PGN(tags map[string]string) string {
+	out := &bytes.Buffer{}
+
+	all := map[string]string{
+		"Event":  "?",
+		"Site":   "?",
+		"Date":   "????.??.??",
+		"Round":  "?",
+		"White":  "?",
+		"Black":  "?",
+		"Result": "*",
+	}
+	for k, v := range tags {
+		all[k] = v
+	}
+
+	root := n.Root()
+	if fen := root.Position.FEN(); fen != StartingPosition(root.Position.Variant).FEN() {
+		all["SetUp"] = "1"
+		all["FEN"] = fen
+	}
+
+	extra := []string{}
+	for k := range all {
+		roster := false
+		for _, r := range pgnRoster {
+			roster = roster || r == k
+		}
+		if !roster {
+			extra = append(extra, k)
+		}
+	}
+	sort.Strings(extra)
+
+	for _, k := range append(pgnRoster, extra...) {
+		fmt.Fprintf(out, "[%s \"%s\"]\n", k, strings.Replace(all[k], `"`, `\"`, -1))
+	}
+	out.WriteString("\n")
+
+	words := []string{}
+	if root.Comment != "" {
+		words = append(words, "{"+root.Comment+"}")
+	}
+	words = root.movetext(words, true)
+	words = append(words, all["Result"])
+
+	// PGN lines are supposed to stay under 80 characters
+	line := 0
+	for i, w := range words {
+		if i > 0 && line+1+len(w) > 79 {
+			out.WriteString("\n")
+			line = 0
+		} else if i > 0 {
+			out.WriteString(" ")
+			line++
+		}
+		out.WriteString(w)
+		line += len(w)
+	}
+	out.WriteString("\n")
+
+	return out.String()
+}
+
+// words returns a move with its number (if it needs one), NAGs and comment
+func (n *Node) words(number bool) []string {
+	p := n.Parent.Position
+	ret := []string{}
+
+	switch {
+	case p.WhiteToMove:
+		ret = append(ret, fmt.Sprintf("%d.", p.FullMoves))
+	case number:
+		ret = append(ret, fmt.Sprintf("%d...", p.FullMoves))
+	}
+
+	ret = append(ret, n.Move)
+	for _, nag := range n.NAGs {
+		ret = append(ret, fmt.Sprintf("$%d", nag))
+	}
+
+	if n.Comment != "" {
+		ret = append(ret, "{"+n.Comment+"}")
+	}
+
+	return ret
+}
+
+// movetext appends the moves after this node, variations in parentheses;
+// number is true when black's move needs its number written out
+func (n *Node) movetext(words []string, number bool) []string {
+	for len(n.Children) > 0 {
+		main := n.Children[0]
+		words = append(words, main.words(number)...)
+
+		for _, v := range n.Children[1:] {
+			variation := v.movetext(v.words(true), v.Comment != "")
+			variation[0] = "(" + variation[0]
+			variation[len(variation)-1] += ")"
+			words = append(words, variation...)
+		}
+
+		number = len(n.Children) > 1 || main.Comment != ""
+		n = main
+	}
+
+	return words
+}
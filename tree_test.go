@@ -0,0 +1,142 @@
+package chess
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+// playAll plays moves from a node, failing the test if any won't play
+func playAll(t *testing.T, n *Node, moves ...string) *Node {
+	for _, move := range moves {
+		next, err := n.Play(move)
+		if err != nil {
+			t.Fatalf("%s: %s", move, err)
+		}
+		n = next
+	}
+	return n
+}
+
+// movetextOf is a game's PGN without the tags
+func movetextOf(n *Node) string {
+	pgn := n.PGN(nil)
+	return strings.TrimSpace(pgn[strings.Index(pgn, "\n\n")+2:])
+}
+
+func TestTreeVariations(t *testing.T) {
+	root := NewGame(StartingPosition(VARIANT_STANDARD))
+
+	e5 := playAll(t, root, "e4", "e5")
+	playAll(t, e5, "Nf3", "Nc6")
+	c5 := playAll(t, root.Children[0], "c5")
+	playAll(t, c5, "Nf3")
+
+	// playing a move again finds the node that's there
+	if again := playAll(t, root, "E2-E4"); again != root.Children[0] || len(root.Children) != 1 {
+		t.Error("e4 was added twice")
+	}
+
+	if got := movetextOf(root); got != "1. e4 e5 (1... c5 2. Nf3) 2. Nf3 Nc6 *" {
+		t.Errorf("PGN is %q", got)
+	}
+
+	if !e5.IsMainline() || c5.IsMainline() || len(c5.Line()) != 2 || len(root.Mainline()) != 4 {
+		t.Errorf("mainline is wrong")
+	}
+
+	c5.Promote()
+	if got := movetextOf(root); got != "1. e4 c5 (1... e5 2. Nf3 Nc6) 2. Nf3 *" {
+		t.Errorf("after promoting c5, PGN is %q", got)
+	}
+	if !c5.IsMainline() || e5.IsMainline() {
+		t.Error("promoting c5 didn't make it the main line")
+	}
+
+	e5.Delete()
+	if got := movetextOf(root); got != "1. e4 c5 2. Nf3 *" {
+		t.Errorf("after deleting e5, PGN is %q", got)
+	}
+	if e5.Parent != nil {
+		t.Error("deleted node still has a parent")
+	}
+
+	// deleting or promoting the root does nothing
+	root.Delete()
+	root.Promote()
+	if len(root.Mainline()) != 3 {
+		t.Error("the root was changed")
+	}
+}
+
+func TestTreePGN(t *testing.T) {
+	p, _ := ParseFEN("4k3/8/8/8/8/8/4P3/4K3 b - - 0 20")
+	root := NewGame(p)
+	root.Comment = "a pawn up"
+
+	kd7 := playAll(t, root, "Kd7")
+	kd7.NAGs = []int{2}
+	e4 := playAll(t, kd7, "e4")
+	e4.Comment = "pushing"
+	playAll(t, e4, "Ke6")
+	playAll(t, root, "Ke7", "e4")
+
+	pgn := root.PGN(map[string]string{"White": "alice", "Black": "bob", "Result": "1/2-1/2", "Annotator": `"the" bot`})
+	want := `[Event "?"]
+[Site "?"]
+[Date "????.??.??"]
+[Round "?"]
+[White "alice"]
+[Black "bob"]
+[Result "1/2-1/2"]
+[Annotator "\"the\" bot"]
+[FEN "4k3/8/8/8/8/8/4P3/4K3 b - - 0 20"]
+[SetUp "1"]
+
+{a pawn up} 20... Kd7 $2 (20... Ke7 21. e4) 21. e4 {pushing} 21... Ke6 1/2-1/2
+`
+	if pgn != want {
+		t.Errorf("PGN is\n%s\nnot\n%s", pgn, want)
+	}
+
+	// long games wrap before 80 columns
+	root = NewGame(StartingPosition(VARIANT_STANDARD))
+	moves, _ := RandomGame(1, 120)
+	n := root
+	for _, move := range moves {
+		n = playAll(t, n, move)
+	}
+	for _, l := range strings.Split(root.PGN(nil), "\n") {
+		if len(l) > 79 {
+			t.Errorf("%d characters: %s", len(l), l)
+		}
+	}
+}
+
+func TestTreeJSON(t *testing.T) {
+	root := NewGame(StartingPosition(VARIANT_STANDARD))
+	playAll(t, root, "d4", "d5", "c4")
+	c4 := playAll(t, root, "d4", "Nf6", "c4")
+
+	data, err := json.Marshal(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var loaded Node
+	if err := json.Unmarshal(data, &loaded); err != nil {
+		t.Fatal(err)
+	}
+
+	found := loaded.Follow(c4.Path())
+	if found.Move != "c4" || found.Parent.Move != "Nf6" || found.Root() != &loaded {
+		t.Errorf("followed %v to %q", c4.Path(), found.Move)
+	}
+	if movetextOf(&loaded) != movetextOf(root) {
+		t.Errorf("loaded %q", movetextOf(&loaded))
+	}
+
+	if n := loaded.Follow([]int{0, 5, 0}); n != loaded.Children[0] {
+		t.Error("Follow didn't stop where the path left the tree")
+	}
+}